@@ -0,0 +1,229 @@
+package ast
+
+import "fmt"
+
+// ApplyFunc is called by Apply for each node. The result controls the traversal,
+// see Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses the tree recursively, starting with root, and calls pre
+// and post for each node. Either function may be nil.
+//
+// If pre returns false, the node's children are skipped and post isn't called
+// for it. If post returns false, the traversal stops and Apply returns.
+//
+// The functions may change the current node with the Cursor's Replace, Delete,
+// InsertBefore, and InsertAfter methods. Replacements made by pre are traversed,
+// inserted and deleted nodes aren't. Apply returns the root, which may have been replaced.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = root
+	}()
+	a := applier{pre: pre, post: post}
+	a.apply(nil, nil, nil, func(n Node) { root = n }, root)
+	return
+}
+
+var abort = new(int) // unique sentinel used to stop the traversal
+
+// Cursor describes a node encountered by Apply
+type Cursor struct {
+	parent Node
+	list   list       // the parent's slice containing the node, nil if it isn't in one
+	iter   *iteration // the position in list
+	set    func(Node) // replaces the node when it isn't in a slice
+	node   Node
+	del    bool // the node has been deleted
+}
+
+// Node returns the current node
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current node, it's nil for the root
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Index returns the index of the current node in the parent's entries, labels,
+// or list values. It's -1 if the node isn't in one of them.
+func (c *Cursor) Index() int {
+	if c.list == nil {
+		return -1
+	}
+	return c.iter.index
+}
+
+// Replace replaces the current node with n. It panics if n's type
+// cannot be stored where the current node is.
+func (c *Cursor) Replace(n Node) {
+	if c.del {
+		panic("ast.Cursor.Replace: node was deleted")
+	}
+	if c.list != nil {
+		c.list.set(c.iter.index, n)
+	} else {
+		c.set(n)
+	}
+	c.node = n
+}
+
+// Delete deletes the current node from its parent's slice.
+// It panics if the node isn't in one.
+func (c *Cursor) Delete() {
+	if c.del {
+		panic("ast.Cursor.Delete: node was deleted")
+	}
+	c.slice("Delete").delete(c.iter.index)
+	c.iter.step--
+	c.del = true
+}
+
+// InsertBefore inserts n before the current node in its parent's slice.
+// It panics if the node isn't in one. Apply doesn't traverse n.
+func (c *Cursor) InsertBefore(n Node) {
+	c.slice("InsertBefore").insert(c.iter.index, n)
+	c.iter.index++
+}
+
+// InsertAfter inserts n after the current node in its parent's slice.
+// It panics if the node isn't in one. Apply doesn't traverse n.
+func (c *Cursor) InsertAfter(n Node) {
+	c.slice("InsertAfter").insert(c.iter.index+1, n)
+	c.iter.step++
+}
+
+// slice returns the slice containing the node or panics
+func (c *Cursor) slice(method string) list {
+	if c.list == nil {
+		panic(fmt.Sprintf("ast.Cursor.%s: %T isn't in a slice", method, c.node))
+	}
+	return c.list
+}
+
+// iteration is the state of a loop over a slice
+type iteration struct {
+	index int // the current node's index
+	step  int // added to index to get the next node's index
+}
+
+// applier holds the state of an Apply call
+type applier struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+}
+
+// apply calls the functions for n and traverses its children
+func (a *applier) apply(parent Node, l list, iter *iteration, set func(Node), n Node) {
+	saved := a.cursor
+	a.cursor = Cursor{parent: parent, list: l, iter: iter, set: set, node: n}
+	defer func() { a.cursor = saved }()
+	if a.pre != nil && (!a.pre(&a.cursor) || a.cursor.del) {
+		return
+	}
+	switch n := a.cursor.node.(type) {
+	case *Block:
+		a.list(n, entryList{n})
+	case *Entry:
+		if n.Name != nil {
+			a.apply(n, nil, nil, func(x Node) { n.Name = x.(*Ident) }, n.Name)
+		}
+		a.list(n, labelList{n})
+		if n.Value != nil {
+			a.apply(n, nil, nil, func(x Node) { n.Value = x.(Value) }, n.Value)
+		}
+	case *List:
+		a.list(n, valueList{n})
+	case *Include:
+		if n.Path != nil {
+			a.apply(n, nil, nil, func(x Node) { n.Path = x.(*String) }, n.Path)
+		}
+	}
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+}
+
+// list applies the functions to the nodes in the parent's slice
+func (a *applier) list(parent Node, l list) {
+	iter := &iteration{}
+	for iter.index < l.len() {
+		iter.step = 1
+		a.apply(parent, l, iter, nil, l.get(iter.index))
+		iter.index += iter.step
+	}
+}
+
+// list is a slice of nodes in a parent node
+type list interface {
+	len() int
+	get(i int) Node
+	set(i int, n Node)
+	insert(i int, n Node)
+	delete(i int)
+}
+
+// entryList is a block's entries
+type entryList struct{ b *Block }
+
+func (l entryList) len() int          { return len(l.b.Entries) }
+func (l entryList) get(i int) Node    { return l.b.Entries[i] }
+func (l entryList) set(i int, n Node) { l.b.Entries[i] = n.(*Entry) }
+
+func (l entryList) insert(i int, n Node) {
+	l.b.Entries = append(l.b.Entries, nil)
+	copy(l.b.Entries[i+1:], l.b.Entries[i:])
+	l.b.Entries[i] = n.(*Entry)
+}
+
+func (l entryList) delete(i int) {
+	l.b.Entries = append(l.b.Entries[:i], l.b.Entries[i+1:]...)
+}
+
+// labelList is an entry's labels
+type labelList struct{ e *Entry }
+
+func (l labelList) len() int          { return len(l.e.Labels) }
+func (l labelList) get(i int) Node    { return l.e.Labels[i] }
+func (l labelList) set(i int, n Node) { l.e.Labels[i] = n.(*Label) }
+
+func (l labelList) insert(i int, n Node) {
+	l.e.Labels = append(l.e.Labels, nil)
+	copy(l.e.Labels[i+1:], l.e.Labels[i:])
+	l.e.Labels[i] = n.(*Label)
+}
+
+func (l labelList) delete(i int) {
+	l.e.Labels = append(l.e.Labels[:i], l.e.Labels[i+1:]...)
+}
+
+// valueList is a list's values. The comments attached to
+// a value move with it when it's replaced.
+type valueList struct{ l *List }
+
+func (l valueList) len() int       { return len(l.l.Values) }
+func (l valueList) get(i int) Node { return l.l.Values[i] }
+
+func (l valueList) set(i int, n Node) {
+	old, v := l.l.Values[i], n.(Value)
+	l.l.Values[i] = v
+	for _, m := range []map[Value]*CommentGroup{l.l.Leading, l.l.Trailing} {
+		if g, ok := m[old]; ok {
+			delete(m, old)
+			m[v] = g
+		}
+	}
+}
+
+func (l valueList) insert(i int, n Node) {
+	l.l.Values = append(l.l.Values, nil)
+	copy(l.l.Values[i+1:], l.l.Values[i:])
+	l.l.Values[i] = n.(Value)
+}
+
+func (l valueList) delete(i int) {
+	old := l.l.Values[i]
+	l.l.Values = append(l.l.Values[:i], l.l.Values[i+1:]...)
+	delete(l.l.Leading, old)
+	delete(l.l.Trailing, old)
+}
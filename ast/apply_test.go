@@ -0,0 +1,115 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestApply(t *testing.T) {
+	input := strings.Join([]string{
+		`a = 1`,
+		`debug = true`,
+		`b "x" {`,
+		`  c = [`,
+		`    // two`,
+		`    2,`,
+		`    3,`,
+		`  ]`,
+		`}`,
+	}, "\n")
+	block, err := Parse(input)
+	assert.NilError(t, err)
+	var parents []string
+	pre := func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case *Entry:
+			switch n.Name.Value {
+			case "debug":
+				c.Delete()
+				return false
+			case "a":
+				c.InsertAfter(&Entry{Name: &Ident{Value: "z"}, Value: &Bool{Value: false}})
+			}
+		case *Label:
+			c.InsertBefore(&Label{Text: "w"})
+			c.Replace(&Label{Text: "y"})
+		case *Number:
+			if _, ok := c.Parent().(*List); ok {
+				parents = append(parents, strconv.Itoa(c.Index()))
+			}
+			if n.Text == "3" {
+				c.Delete()
+			}
+		}
+		return true
+	}
+	post := func(c *Cursor) bool {
+		if n, ok := c.Node().(*Number); ok {
+			c.Replace(&Number{Text: n.Text + "0"})
+		}
+		return true
+	}
+	result := Apply(block, pre, post)
+	assert.Equal(t, result, Node(block))
+	assert.Equal(t, dump(block), strings.Join([]string{
+		`*ast.Block 1:1-9:2`,
+		`  *ast.Entry 1:1-0:0`,
+		`    Ident a 1:1-1:2`,
+		`    Number 10 0:0-0:0`,
+		`  *ast.Entry 0:0-0:0`,
+		`    Ident z 0:0-0:0`,
+		`    Bool false 0:0-0:0`,
+		`  *ast.Entry 3:1-9:2`,
+		`    Ident b 3:1-3:2`,
+		`    Label w 0:0-0:0`,
+		`    Label y 0:0-0:0`,
+		`    *ast.Block 3:7-9:2`,
+		`      *ast.Entry 4:3-8:4`,
+		`        Ident c 4:3-4:4`,
+		`        *ast.List 4:7-8:4`,
+		`          Number 20 0:0-0:0`,
+		``,
+	}, "\n"))
+	assert.DeepEqual(t, parents, []string{"0", "1"})
+	list := block.Entries[2].Value.(*Block).Entries[0].Value.(*List)
+	assert.Equal(t, list.Leading[list.Values[0]].Text(), "two\n")
+	assert.Equal(t, len(list.Leading), 1)
+}
+
+func TestApplyStop(t *testing.T) {
+	block, err := Parse("a = 1\nb = 2\nc = 3")
+	assert.NilError(t, err)
+	var names []string
+	result := Apply(block, nil, func(c *Cursor) bool {
+		if e, ok := c.Node().(*Entry); ok {
+			names = append(names, e.Name.Value)
+			return e.Name.Value != "b"
+		}
+		return true
+	})
+	assert.DeepEqual(t, names, []string{"a", "b"})
+	assert.Equal(t, result, Node(block))
+
+	root := &Block{}
+	result = Apply(block, func(c *Cursor) bool {
+		assert.Equal(t, c.Index(), -1)
+		assert.Assert(t, c.Parent() == nil)
+		c.Replace(root)
+		return false
+	}, nil)
+	assert.Equal(t, result, Node(root))
+
+	assert.Assert(t, func() (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		Apply(block, func(c *Cursor) bool {
+			if _, ok := c.Node().(*Ident); ok {
+				c.Delete()
+			}
+			return true
+		}, nil)
+		return false
+	}())
+}
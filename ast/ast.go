@@ -2,19 +2,31 @@ package ast
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/icholy/config/token"
 )
 
+// Node is implemented by all the syntax tree nodes.
+// Comments aren't nodes, they're attached to entries and lists.
+type Node interface {
+	Pos() token.Pos // position of the first character of the node
+	End() token.Pos // position of the end of the node
+}
+
 // Value ...
 type Value interface {
+	Node
 	value()
 }
 
 // Block is a collection of entries
 type Block struct {
 	Start   token.Pos
+	Stop    token.Pos
 	Entries []*Entry
+	Footer  *CommentGroup // comments after the last entry
+	Inline  bool          // written as a value, e.g. a = {b = 1, c = 2}
 }
 
 func (Block) value() {}
@@ -25,10 +37,20 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 	for _, e := range b.Entries {
 		name := e.Name.Value
 		if b0, ok := e.Value.(*Block); ok {
-			if blocks, ok := m[name].([]Value); ok {
-				m[name] = append(blocks, b0)
+			// labels become nested objects
+			parent := m
+			for _, l := range e.Labels {
+				child, ok := parent[name].(map[string]interface{})
+				if !ok {
+					child = map[string]interface{}{}
+					parent[name] = child
+				}
+				parent, name = child, l.Value
+			}
+			if blocks, ok := parent[name].([]Value); ok {
+				parent[name] = append(blocks, b0)
 			} else {
-				m[name] = []Value{b0}
+				parent[name] = []Value{b0}
 			}
 		} else {
 			m[name] = e.Value
@@ -40,6 +62,7 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 // Ident ...
 type Ident struct {
 	Start token.Pos
+	Stop  token.Pos
 	Value string
 }
 
@@ -50,8 +73,11 @@ func (i *Ident) MarshalJSON() ([]byte, error) {
 
 // Number ...
 type Number struct {
-	Start token.Pos
-	Value float64
+	Start   token.Pos
+	Stop    token.Pos
+	Value   float64
+	Text    string // literal as it appears in the source
+	Integer bool   // the literal has no fraction or exponent
 }
 
 func (Number) value() {}
@@ -61,9 +87,26 @@ func (n *Number) MarshalJSON() ([]byte, error) {
 	return json.Marshal(n.Value)
 }
 
+// Quantity is a number with a unit suffix, e.g. 30s or 512KiB
+type Quantity struct {
+	Start token.Pos
+	Stop  token.Pos
+	Value int64 // nanoseconds for durations, bytes for sizes
+	Unit  Unit
+	Text  string // literal as it appears in the source
+}
+
+func (Quantity) value() {}
+
+// MarshalJSON implements json.Marshaler
+func (q *Quantity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.Text)
+}
+
 // Bool ...
 type Bool struct {
 	Start token.Pos
+	Stop  token.Pos
 	Value bool
 }
 
@@ -77,9 +120,24 @@ func (b *Bool) MarshalJSON() ([]byte, error) {
 // String ...
 type String struct {
 	Start token.Pos
+	Stop  token.Pos
 	Value string
+	Text  string // literal as it appears in the source, including quotes
+	Kind  StringKind
 }
 
+// StringKind is the syntax used to write a String
+type StringKind int
+
+const (
+	// Quoted strings are double quoted and can contain escape sequences
+	Quoted StringKind = iota
+	// Raw strings are backtick quoted and don't interpret escape sequences
+	Raw
+	// Heredoc strings start with <<MARKER or <<-MARKER and end with MARKER on its own line
+	Heredoc
+)
+
 func (String) value() {}
 
 // MarshalJSON implements json.Marshaler
@@ -87,10 +145,41 @@ func (s *String) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.Value)
 }
 
+// Null is the null literal
+type Null struct {
+	Start token.Pos
+	Stop  token.Pos
+}
+
+func (Null) value() {}
+
+// MarshalJSON implements json.Marshaler
+func (n *Null) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// Reset is the !reset marker. It clears the value of the key it's
+// assigned to, including values inherited from merged blocks.
+type Reset struct {
+	Start token.Pos
+	Stop  token.Pos
+}
+
+func (Reset) value() {}
+
+// MarshalJSON implements json.Marshaler
+func (r *Reset) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
 // List ...
 type List struct {
-	Start  token.Pos
-	Values []Value
+	Start    token.Pos
+	Stop     token.Pos
+	Values   []Value
+	Leading  map[Value]*CommentGroup // comments above a value
+	Trailing map[Value]*CommentGroup // comments on the same line as a value
+	Footer   *CommentGroup           // comments after the last value
 }
 
 func (List) value() {}
@@ -100,11 +189,43 @@ func (l *List) MarshalJSON() ([]byte, error) {
 	return json.Marshal(l.Values)
 }
 
+// Include is an include directive, e.g. include "services/*.conf".
+// It's the value of an entry named include and is replaced with the
+// entries of the files it matches by ExpandIncludes.
+type Include struct {
+	Start token.Pos
+	Stop  token.Pos
+	Path  *String
+}
+
+func (Include) value() {}
+
+// MarshalJSON implements json.Marshaler
+func (i *Include) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Path)
+}
+
+// Label is a string or identifier between an entry's name and its block
+type Label struct {
+	Start token.Pos
+	Stop  token.Pos
+	Value string
+	Text  string // literal as it appears in the source
+}
+
+// MarshalJSON implements json.Marshaler
+func (l *Label) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.Value)
+}
+
 // Entry is a key/value pair
 type Entry struct {
-	Start token.Pos
-	Name  *Ident
-	Value Value
+	Start    token.Pos
+	Name     *Ident
+	Labels   []*Label // only blocks can have labels
+	Value    Value
+	Leading  *CommentGroup // comments above the entry
+	Trailing *CommentGroup // comment on the same line as the end of the entry
 }
 
 // MarshalJSON implements json.Marshaler
@@ -117,3 +238,66 @@ func (e *Entry) MarshalJSON() ([]byte, error) {
 		Value: e.Value,
 	})
 }
+
+// Comment is a single line comment
+type Comment struct {
+	Start token.Pos
+	Text  string
+}
+
+// CommentGroup is a sequence of comments
+type CommentGroup struct {
+	List []*Comment
+}
+
+// Text returns the comment text without the comment markers
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range g.List {
+		b.WriteString(strings.TrimSpace(strings.TrimPrefix(c.Text, "//")))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Pos and End implementations for the nodes
+
+func (b *Block) Pos() token.Pos    { return b.Start }
+func (i *Ident) Pos() token.Pos    { return i.Start }
+func (n *Number) Pos() token.Pos   { return n.Start }
+func (q *Quantity) Pos() token.Pos { return q.Start }
+func (b *Bool) Pos() token.Pos     { return b.Start }
+func (s *String) Pos() token.Pos   { return s.Start }
+func (n *Null) Pos() token.Pos     { return n.Start }
+func (r *Reset) Pos() token.Pos    { return r.Start }
+func (l *List) Pos() token.Pos     { return l.Start }
+func (i *Include) Pos() token.Pos  { return i.Start }
+func (l *Label) Pos() token.Pos    { return l.Start }
+func (e *Entry) Pos() token.Pos    { return e.Start }
+
+func (b *Block) End() token.Pos    { return b.Stop }
+func (i *Ident) End() token.Pos    { return i.Stop }
+func (n *Number) End() token.Pos   { return n.Stop }
+func (q *Quantity) End() token.Pos { return q.Stop }
+func (b *Bool) End() token.Pos     { return b.Stop }
+func (s *String) End() token.Pos   { return s.Stop }
+func (n *Null) End() token.Pos     { return n.Stop }
+func (r *Reset) End() token.Pos    { return r.Stop }
+func (l *List) End() token.Pos     { return l.Stop }
+func (i *Include) End() token.Pos  { return i.Stop }
+func (l *Label) End() token.Pos    { return l.Stop }
+
+// End returns the end of the entry's value
+func (e *Entry) End() token.Pos {
+	switch {
+	case e.Value != nil:
+		return e.Value.End()
+	case len(e.Labels) > 0:
+		return e.Labels[len(e.Labels)-1].Stop
+	default:
+		return e.Name.Stop
+	}
+}
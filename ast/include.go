@@ -0,0 +1,152 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/icholy/config/token"
+)
+
+// IncludeError is returned when an include directive cannot be expanded
+type IncludeError struct {
+	Include *Include
+	Err     error
+}
+
+// Error implements the error interface
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Include.Start, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// Position implements token.Positioner
+func (e *IncludeError) Position() token.Pos {
+	return e.Include.Start
+}
+
+// ParseFS parses the named file from fsys and expands its include directives
+func ParseFS(fsys fs.FS, name string) (*Block, error) {
+	x := includer{fsys: fsys}
+	return x.file(path.Clean(name))
+}
+
+// ExpandIncludes replaces the include directives in b, and its nested blocks,
+// with the entries of the files they match. The path of an include is a glob
+// pattern, patterns without meta characters must match an existing file, but
+// it isn't an error for a pattern with meta characters to match nothing.
+// The name is the file b was parsed from and relative paths are resolved from
+// its directory. If name is empty, they're resolved from the root of fsys.
+// Included files are expanded recursively and include cycles are reported as errors.
+// If fsys is nil, every include directive is an error.
+func ExpandIncludes(fsys fs.FS, name string, b *Block) error {
+	x := includer{fsys: fsys}
+	if name != "" {
+		name = path.Clean(name)
+		x.stack = []string{name}
+	}
+	return x.block(name, b)
+}
+
+// includer expands include directives
+type includer struct {
+	fsys  fs.FS
+	stack []string // the files being expanded, used to detect cycles
+}
+
+// file parses the named file and expands its includes
+func (x *includer) file(name string) (*Block, error) {
+	f, err := x.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var errs token.ErrorList
+	b, err := ParseReader(name, f)
+	errs.Add(err)
+	x.stack = append(x.stack, name)
+	errs.Add(x.block(name, b))
+	x.stack = x.stack[:len(x.stack)-1]
+	return b, errs.Err()
+}
+
+// block expands the includes in b. The name is the file b is in.
+func (x *includer) block(name string, b *Block) error {
+	var errs token.ErrorList
+	entries := make([]*Entry, 0, len(b.Entries))
+	for _, e := range b.Entries {
+		switch v := e.Value.(type) {
+		case *Include:
+			ee, err := x.include(name, v)
+			errs.Add(err)
+			entries = append(entries, ee...)
+		case *Block:
+			errs.Add(x.block(name, v))
+			entries = append(entries, e)
+		default:
+			entries = append(entries, e)
+		}
+	}
+	b.Entries = entries
+	return errs.Err()
+}
+
+// include returns the entries of the files matched by the include directive
+func (x *includer) include(name string, inc *Include) ([]*Entry, error) {
+	if x.fsys == nil {
+		return nil, &IncludeError{Include: inc, Err: errors.New("include directives are not enabled")}
+	}
+	pattern := inc.Path.Value
+	if !path.IsAbs(pattern) {
+		pattern = path.Join(path.Dir(name), pattern)
+	}
+	matches := []string{pattern}
+	if hasMeta(pattern) {
+		var err error
+		if matches, err = fs.Glob(x.fsys, pattern); err != nil {
+			return nil, &IncludeError{Include: inc, Err: err}
+		}
+	}
+	var entries []*Entry
+	var errs token.ErrorList
+	for _, match := range matches {
+		if err := x.cycle(match); err != nil {
+			errs.Add(&IncludeError{Include: inc, Err: err})
+			continue
+		}
+		b, err := x.file(match)
+		if err != nil {
+			// parse errors are positioned in the included file
+			if _, ok := err.(token.ErrorList); !ok {
+				err = &IncludeError{Include: inc, Err: err}
+			}
+			errs.Add(err)
+		}
+		if b != nil {
+			entries = append(entries, b.Entries...)
+		}
+	}
+	return entries, errs.Err()
+}
+
+// cycle returns an error if the file is already being expanded
+func (x *includer) cycle(name string) error {
+	for i, s := range x.stack {
+		if s == name {
+			files := append(x.stack[i:len(x.stack):len(x.stack)], name)
+			return fmt.Errorf("include cycle: %s", strings.Join(files, " -> "))
+		}
+	}
+	return nil
+}
+
+// hasMeta returns true if the path contains glob meta characters
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
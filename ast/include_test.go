@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.conf":           {Data: []byte("a = 1\ninclude \"services/*.conf\"\nBlock {\n  include \"common.conf\"\n}\nz = 1")},
+		"common.conf":         {Data: []byte("common = 1")},
+		"services/api.conf":   {Data: []byte("Service \"api\" {}\ninclude \"../common.conf\"")},
+		"services/web.conf":   {Data: []byte("\nService \"web\" {}")},
+		"services/readme.txt": {Data: []byte("not included")},
+	}
+	block, err := ParseFS(fsys, "main.conf")
+	assert.NilError(t, err)
+	var names []string
+	for _, e := range block.Entries {
+		names = append(names, e.Name.Value+"@"+e.Start.String())
+	}
+	assert.DeepEqual(t, names, []string{
+		"a@main.conf:1:1",
+		"Service@services/api.conf:1:1",
+		"common@common.conf:1:1",
+		"Service@services/web.conf:2:1",
+		"Block@main.conf:3:1",
+		"z@main.conf:6:1",
+	})
+	inner := block.Entries[4].Value.(*Block)
+	assert.Equal(t, len(inner.Entries), 1)
+	assert.Equal(t, inner.Entries[0].Name.Start.String(), "common.conf:1:1")
+}
+
+func TestExpandIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/main.conf":  {Data: []byte("include \"extra.conf\"")},
+		"conf/extra.conf": {Data: []byte("extra = 1")},
+	}
+	block, err := Parse("include \"conf/main.conf\"")
+	assert.NilError(t, err)
+	assert.NilError(t, ExpandIncludes(fsys, "", block))
+	assert.Equal(t, len(block.Entries), 1)
+	assert.Equal(t, block.Entries[0].Start.String(), "conf/extra.conf:1:1")
+
+	// a glob which matches nothing isn't an error
+	block, err = Parse("a = 1\ninclude \"conf.d/*.conf\"")
+	assert.NilError(t, err)
+	assert.NilError(t, ExpandIncludes(fsys, "conf/main.conf", block))
+	assert.Equal(t, len(block.Entries), 1)
+
+	block, err = Parse("include \"conf/main.conf\"")
+	assert.NilError(t, err)
+	err = ExpandIncludes(nil, "", block)
+	assert.Error(t, err, "1:1: include directives are not enabled")
+}
+
+func TestIncludeErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"missing.conf": {Data: []byte("a = 1\n\ninclude \"nothing.conf\"\ninclude \"nothing/*.conf\"")},
+		"a.conf":       {Data: []byte("include \"b.conf\"")},
+		"b.conf":       {Data: []byte("include \"a.conf\"")},
+		"self.conf":    {Data: []byte("include \"self.conf\"")},
+		"bad.conf":     {Data: []byte("ok = 1\ninclude \"syntax.conf\"")},
+		"syntax.conf":  {Data: []byte("a = \nb = 2")},
+		"glob.conf":    {Data: []byte("include \"[\"")},
+	}
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{
+			name:    "missing.conf",
+			message: "missing.conf:3:1: open nothing.conf: file does not exist",
+		},
+		{
+			name:    "a.conf",
+			message: "b.conf:1:1: include cycle: a.conf -> b.conf -> a.conf",
+		},
+		{
+			name:    "self.conf",
+			message: "self.conf:1:1: include cycle: self.conf -> self.conf",
+		},
+		{
+			name:    "bad.conf",
+			message: "syntax.conf:1:5: unexpected token NEWLINE(\"\")",
+		},
+		{
+			name:    "glob.conf",
+			message: "glob.conf:1:1: syntax error in pattern",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFS(fsys, tt.name)
+			assert.Error(t, err, tt.message)
+		})
+	}
+	_, err := ParseFS(fsys, "missing.conf")
+	assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+}
@@ -1,8 +1,13 @@
 package ast
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/icholy/config/token"
 )
@@ -11,30 +16,82 @@ import (
 // encountered when parsing
 type ParseError struct {
 	Token token.Token
+	Err   error // why the token is invalid, nil if it was unexpected
 }
 
 // Error implements the error interface
 func (p ParseError) Error() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s: %v", p.Token.Start, p.Err)
+	}
 	return fmt.Sprintf("%s: unexpected token %s", p.Token.Start, p.Token)
 }
 
+// Unwrap returns the underlying error
+func (p ParseError) Unwrap() error {
+	return p.Err
+}
+
+// Position implements token.Positioner
+func (p ParseError) Position() token.Pos {
+	return p.Token.Start
+}
+
 // Parser for the configuration language
 type Parser struct {
-	lex *token.Lexer
-	tok token.Token
+	lex   *token.Lexer
+	tok   token.Token
+	start token.Pos
+	// end is the position after the last consumed token which wasn't a newline
+	end token.Pos
+	// comments which have been read but not attached to a node yet
+	comments []*Comment
+	// errors encountered so far
+	errors token.ErrorList
 }
 
 // NewParser constructs a new parser
 func NewParser(lex *token.Lexer) *Parser {
-	return &Parser{
-		lex: lex,
-		tok: lex.Next(),
-	}
+	p := &Parser{lex: lex, start: lex.Pos()}
+	p.next()
+	return p
 }
 
-// next reads the next token from the lexer
+// next reads the next token from the lexer.
+// comment tokens are buffered so they can be attached to nodes later.
 func (p *Parser) next() {
+	if p.tok.Type != token.NEWLINE {
+		p.end = p.lex.Pos()
+	}
 	p.tok = p.lex.Next()
+	for p.tok.Type == token.COMMENT {
+		p.comments = append(p.comments, &Comment{
+			Start: p.tok.Start,
+			Text:  p.tok.Text,
+		})
+		p.tok = p.lex.Next()
+	}
+}
+
+// leading returns all buffered comments as a group
+func (p *Parser) leading() *CommentGroup {
+	if len(p.comments) == 0 {
+		return nil
+	}
+	g := &CommentGroup{List: p.comments}
+	p.comments = nil
+	return g
+}
+
+// trailing returns the buffered comment if it's on the same line
+// as the end of the last consumed token
+func (p *Parser) trailing() *CommentGroup {
+	if len(p.comments) == 0 || p.comments[0].Start.Line != p.end.Line {
+		return nil
+	}
+	g := &CommentGroup{List: p.comments[:1]}
+	p.comments = p.comments[1:]
+	return g
 }
 
 // expect returns an error if the current token's type doesn't match t
@@ -52,6 +109,64 @@ func (p *Parser) newlines() {
 	}
 }
 
+// sync skips tokens until the end of the current entry so that
+// parsing can continue after an error. Inside inline blocks, a
+// comma also ends the entry.
+func (p *Parser) sync(inline bool) {
+	depth := 0
+	for {
+		switch p.tok.Type {
+		case token.EOF:
+			return
+		case token.NEWLINE:
+			if depth == 0 {
+				return
+			}
+		case token.COMMA:
+			if inline && depth == 0 {
+				return
+			}
+		case token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.RBRACKET:
+			if depth > 0 {
+				depth--
+			}
+		}
+		p.next()
+	}
+}
+
+// syncList skips tokens until the comma after the current list value,
+// or the closing bracket of the list, so that parsing can continue after
+// an error. It stops early at a closing brace or the end of the input.
+func (p *Parser) syncList() {
+	depth := 0
+	for {
+		switch p.tok.Type {
+		case token.EOF:
+			return
+		case token.COMMA:
+			if depth == 0 {
+				return
+			}
+		case token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RBRACKET:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+		p.next()
+	}
+}
+
 // assert panics if the current token type doesn't match t.
 // this helper should only be used in places where it should not ever panic.
 func (p *Parser) assert(t token.Type) {
@@ -61,53 +176,124 @@ func (p *Parser) assert(t token.Type) {
 }
 
 // parse is the entry point. It parses implicit top-level block.
+// The returned block contains all the entries which could be parsed.
 func (p *Parser) parse() (*Block, error) {
 	b := &Block{
-		Start:   token.Pos{Line: 1, Column: 1, Offset: 0},
-		Entries: []*Entry{},
-	}
-	ee, err := p.entries()
-	if err != nil {
-		return nil, err
+		Start: p.start,
 	}
-	b.Entries = ee
-	if err := p.expect(token.EOF); err != nil {
-		return nil, err
+	for {
+		b.Entries = append(b.Entries, p.entries()...)
+		if p.tok.Type == token.EOF {
+			break
+		}
+		// unmatched closing brace
+		p.errors.Add(&ParseError{Token: p.tok})
+		p.next()
 	}
-	return b, nil
+	b.Footer = p.leading()
+	b.Stop = p.tok.Start
+	p.errors.Add(p.lex.Err())
+	return b, p.errors.Err()
 }
 
-// number parses a Number
+// number parses a Number. The special values inf and nan are
+// lexed as identifiers when they don't have a sign.
 func (p *Parser) number() (*Number, error) {
-	p.assert(token.NUMBER)
-	v, err := strconv.ParseFloat(p.tok.Text, 64)
+	n := &Number{
+		Start:   p.tok.Start,
+		Stop:    p.lex.Pos(),
+		Text:    p.tok.Text,
+		Integer: isInteger(p.tok.Text),
+	}
+	if n.Integer {
+		i, ok := new(big.Int).SetString(n.Text, 0)
+		if !ok {
+			return nil, &ParseError{Token: p.tok, Err: fmt.Errorf("invalid number %q", n.Text)}
+		}
+		// integers are exact, huge values can still be decoded into a big.Int
+		n.Value, _ = new(big.Float).SetInt(i).Float64()
+	} else {
+		v, err := strconv.ParseFloat(n.Text, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, &ParseError{Token: p.tok, Err: fmt.Errorf("number %q is out of range", n.Text)}
+		}
+		if err != nil {
+			return nil, &ParseError{Token: p.tok, Err: fmt.Errorf("invalid number %q", n.Text)}
+		}
+		n.Value = v
+	}
+	p.next()
+	return n, nil
+}
+
+// isInteger returns true if the number literal has no fraction or exponent
+func isInteger(text string) bool {
+	text = strings.TrimLeft(text, "+-")
+	if len(text) > 2 && text[0] == '0' && strings.ContainsRune("xXoObB", rune(text[1])) {
+		return true
+	}
+	return text != "inf" && text != "nan" && !strings.ContainsAny(text, ".eE")
+}
+
+// isSpecial returns true if the identifier is a special number value
+func isSpecial(ident string) bool {
+	return ident == "inf" || ident == "nan"
+}
+
+// quantity parses a Quantity
+func (p *Parser) quantity() (*Quantity, error) {
+	p.assert(token.QUANTITY)
+	v, unit, err := ParseQuantity(p.tok.Text)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Token: p.tok, Err: err}
 	}
-	n := &Number{
+	q := &Quantity{
 		Start: p.tok.Start,
+		Stop:  p.lex.Pos(),
 		Value: v,
+		Unit:  unit,
+		Text:  p.tok.Text,
 	}
 	p.next()
-	return n, nil
+	return q, nil
 }
 
 // string parses a String
 func (p *Parser) string() (*String, error) {
 	p.assert(token.STRING)
+	v, err := token.Unquote(p.tok.Text)
+	if err != nil {
+		return nil, &ParseError{Token: p.tok, Err: err}
+	}
 	s := &String{
 		Start: p.tok.Start,
-		Value: p.tok.Text,
+		Stop:  p.lex.Pos(),
+		Value: v,
+		Text:  p.tok.Text,
+		Kind:  stringKind(p.tok.Text),
 	}
 	p.next()
 	return s, nil
 }
 
+// stringKind returns the kind of a string literal
+func stringKind(text string) StringKind {
+	switch text[0] {
+	case '`':
+		return Raw
+	case '<':
+		return Heredoc
+	default:
+		return Quoted
+	}
+}
+
 // bool parses a Bool
 func (p *Parser) bool() (*Bool, error) {
 	p.assert(token.IDENT)
 	b := &Bool{
 		Start: p.tok.Start,
+		Stop:  p.lex.Pos(),
 	}
 	switch p.tok.Text {
 	case "false":
@@ -136,11 +322,23 @@ func (p *Parser) list() (*List, error) {
 			break
 		}
 		// read a value
+		leading := p.leading()
 		v, err := p.value()
 		if err != nil {
-			return nil, err
+			// errors are recorded and the parser skips to the next value
+			p.syncList()
+			if p.tok.Type != token.COMMA && p.tok.Type != token.RBRACKET {
+				return nil, err
+			}
+			p.errors.Add(err)
+			if p.tok.Type == token.RBRACKET {
+				break
+			}
+			p.next()
+			continue
 		}
 		l.Values = append(l.Values, v)
+		l.comment(v, leading, p.trailing())
 		// skip newlines
 		p.newlines()
 		// if there's no comma, we're done
@@ -148,16 +346,39 @@ func (p *Parser) list() (*List, error) {
 			break
 		}
 		p.next()
+		// a comment can also follow the comma
+		l.comment(v, nil, p.trailing())
 	}
 	// skip newlines
 	p.newlines()
+	l.Footer = p.leading()
 	if err := p.expect(token.RBRACKET); err != nil {
 		return nil, err
 	}
+	l.Stop = p.lex.Pos()
 	p.next()
 	return l, nil
 }
 
+// comment attaches comment groups to a list value
+func (l *List) comment(v Value, leading, trailing *CommentGroup) {
+	if leading != nil {
+		if l.Leading == nil {
+			l.Leading = map[Value]*CommentGroup{}
+		}
+		l.Leading[v] = leading
+	}
+	if trailing != nil {
+		if l.Trailing == nil {
+			l.Trailing = map[Value]*CommentGroup{}
+		}
+		if g, ok := l.Trailing[v]; ok {
+			trailing.List = append(g.List, trailing.List...)
+		}
+		l.Trailing[v] = trailing
+	}
+}
+
 // block parses a Block
 func (p *Parser) block() (*Block, error) {
 	p.assert(token.LBRACE)
@@ -165,67 +386,178 @@ func (p *Parser) block() (*Block, error) {
 		Start: p.tok.Start,
 	}
 	p.next()
-	ee, err := p.entries()
-	if err != nil {
+	b.Entries = p.entries()
+	b.Footer = p.leading()
+	if err := p.expect(token.RBRACE); err != nil {
 		return nil, err
 	}
-	b.Entries = ee
-	p.newlines()
+	b.Stop = p.lex.Pos()
+	p.next()
+	return b, nil
+}
+
+// object parses an inline Block. The entries are separated by commas or newlines.
+func (p *Parser) object() (*Block, error) {
+	p.assert(token.LBRACE)
+	b := &Block{
+		Start:  p.tok.Start,
+		Inline: true,
+	}
+	// read left brace
+	p.next()
+	for {
+		p.newlines()
+		if p.tok.Type == token.RBRACE || p.tok.Type == token.EOF {
+			break
+		}
+		// errors are recorded and the parser skips to the next entry
+		e, err := p.inlineEntry()
+		if err != nil {
+			p.errors.Add(err)
+			p.sync(true)
+			if p.tok.Type == token.COMMA {
+				p.next()
+			}
+			continue
+		}
+		b.Entries = append(b.Entries, e)
+		if p.tok.Type == token.COMMA {
+			p.next()
+			// a comment can also follow the comma
+			if g := p.trailing(); g != nil {
+				if e.Trailing != nil {
+					g.List = append(e.Trailing.List, g.List...)
+				}
+				e.Trailing = g
+			}
+		}
+	}
+	b.Footer = p.leading()
 	if err := p.expect(token.RBRACE); err != nil {
 		return nil, err
 	}
+	b.Stop = p.lex.Pos()
 	p.next()
 	return b, nil
 }
 
+// inlineEntry parses an Entry of an inline block. It must be
+// followed by a comma, a newline, or the closing brace.
+func (p *Parser) inlineEntry() (*Entry, error) {
+	if err := p.expect(token.IDENT); err != nil {
+		return nil, err
+	}
+	e, err := p.entry()
+	if err != nil {
+		return nil, err
+	}
+	switch p.tok.Type {
+	case token.COMMA, token.NEWLINE, token.RBRACE:
+		return e, nil
+	default:
+		return nil, &ParseError{Token: p.tok}
+	}
+}
+
 // ident parses an Ident
 func (p *Parser) ident() (*Ident, error) {
 	p.assert(token.IDENT)
 	id := &Ident{
 		Start: p.tok.Start,
+		Stop:  p.lex.Pos(),
 		Value: p.tok.Text,
 	}
 	p.next()
 	return id, nil
 }
 
+// label parses a Label
+func (p *Parser) label() (*Label, error) {
+	l := &Label{
+		Start: p.tok.Start,
+		Stop:  p.lex.Pos(),
+		Value: p.tok.Text,
+		Text:  p.tok.Text,
+	}
+	if p.tok.Type == token.STRING {
+		v, err := token.Unquote(p.tok.Text)
+		if err != nil {
+			return nil, &ParseError{Token: p.tok, Err: err}
+		}
+		l.Value = v
+	}
+	p.next()
+	return l, nil
+}
+
 // value parses a value
 func (p *Parser) value() (Value, error) {
 	switch p.tok.Type {
 	case token.NUMBER:
 		return p.number()
+	case token.QUANTITY:
+		return p.quantity()
 	case token.STRING:
 		return p.string()
 	case token.IDENT:
+		if isSpecial(p.tok.Text) {
+			return p.number()
+		}
+		if p.tok.Text == "null" {
+			n := &Null{
+				Start: p.tok.Start,
+				Stop:  p.lex.Pos(),
+			}
+			p.next()
+			return n, nil
+		}
 		return p.bool()
 	case token.LBRACKET:
 		return p.list()
+	case token.LBRACE:
+		return p.object()
+	case token.RESET:
+		r := &Reset{
+			Start: p.tok.Start,
+			Stop:  p.lex.Pos(),
+		}
+		p.next()
+		return r, nil
 	default:
 		return nil, &ParseError{Token: p.tok}
 	}
 }
 
-// entries parses a sequence of Entry nodes
-func (p *Parser) entries() ([]*Entry, error) {
+// entries parses a sequence of Entry nodes.
+// Errors are recorded and the parser skips to the next entry.
+func (p *Parser) entries() []*Entry {
 	var ee []*Entry
 	for {
 		p.newlines()
-		if p.tok.Type != token.IDENT {
+		if p.tok.Type == token.RBRACE || p.tok.Type == token.EOF {
 			break
 		}
+		if p.tok.Type != token.IDENT {
+			p.errors.Add(&ParseError{Token: p.tok})
+			p.sync(false)
+			continue
+		}
 		e, err := p.entry()
 		if err != nil {
-			return nil, err
+			p.errors.Add(err)
+			p.sync(false)
+			continue
 		}
 		ee = append(ee, e)
 	}
-	return ee, nil
+	return ee
 }
 
 // entry parses an Entry
 func (p *Parser) entry() (*Entry, error) {
 	e := &Entry{
-		Start: p.tok.Start,
+		Start:   p.tok.Start,
+		Leading: p.leading(),
 	}
 	var err error
 	// read name
@@ -233,8 +565,20 @@ func (p *Parser) entry() (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
+	// read labels
+	for p.tok.Type == token.STRING || p.tok.Type == token.IDENT {
+		l, err := p.label()
+		if err != nil {
+			return nil, err
+		}
+		e.Labels = append(e.Labels, l)
+	}
 	switch p.tok.Type {
 	case token.ASSIGN:
+		// only blocks can have labels
+		if len(e.Labels) > 0 {
+			return nil, &ParseError{Token: p.tok}
+		}
 		// skip assign operator
 		p.next()
 		// read value
@@ -249,14 +593,83 @@ func (p *Parser) entry() (*Entry, error) {
 			return nil, err
 		}
 	default:
-		return nil, &ParseError{Token: p.tok}
+		if !p.include(e) {
+			return nil, &ParseError{Token: p.tok}
+		}
 	}
+	e.Trailing = p.trailing()
 	return e, nil
 }
 
-// Parse the input
+// include turns the entry into an include directive if it's
+// the name include followed by a single string label
+func (p *Parser) include(e *Entry) bool {
+	if e.Name.Value != "include" || len(e.Labels) != 1 || !isQuote(e.Labels[0].Text[0]) {
+		return false
+	}
+	switch p.tok.Type {
+	case token.NEWLINE, token.EOF, token.RBRACE:
+	default:
+		return false
+	}
+	l := e.Labels[0]
+	e.Labels = nil
+	e.Value = &Include{
+		Start: e.Name.Start,
+		Stop:  l.Stop,
+		Path: &String{
+			Start: l.Start,
+			Stop:  l.Stop,
+			Value: l.Value,
+			Text:  l.Text,
+			Kind:  stringKind(l.Text),
+		},
+	}
+	return true
+}
+
+// isQuote returns true if ch starts a string literal
+func isQuote(ch byte) bool {
+	return ch == '"' || ch == '`' || ch == '<'
+}
+
+// Parse the input. If there are errors, the returned error is a token.ErrorList
+// and the returned block contains the entries which were parsed successfully.
 func Parse(input string) (*Block, error) {
 	l := token.NewLexer(input)
 	p := NewParser(l)
 	return p.parse()
 }
+
+// ParseValue parses a single value, like the right hand side of an assignment
+func ParseValue(input string) (Value, error) {
+	p := NewParser(token.NewLexer(input))
+	p.newlines()
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.newlines()
+	if err := p.expect(token.EOF); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ParseReader parses the input read from r.
+// The filename is recorded in the position of every node.
+func ParseReader(filename string, r io.Reader) (*Block, error) {
+	l := token.NewFileLexer(filename, r)
+	p := NewParser(l)
+	return p.parse()
+}
+
+// ParseFile parses the named file
+func ParseFile(filename string) (*Block, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseReader(filename, f)
+}
@@ -2,7 +2,9 @@ package ast
 
 import (
 	"encoding/json"
+	"math"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -29,7 +31,19 @@ func TestParse(t *testing.T) {
 				Entries: []*Entry{
 					{
 						Name:  &Ident{Value: "foo"},
-						Value: &Number{Value: 123},
+						Value: &Number{Value: 123, Text: "123", Integer: true},
+					},
+				},
+			},
+		},
+		{
+			name:  "FloatEntry",
+			input: "foo=-1.5",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "foo"},
+						Value: &Number{Value: -1.5, Text: "-1.5"},
 					},
 				},
 			},
@@ -41,7 +55,55 @@ func TestParse(t *testing.T) {
 				Entries: []*Entry{
 					{
 						Name:  &Ident{Value: "bar"},
-						Value: &String{Value: "test"},
+						Value: &String{Value: "test", Text: `"test"`},
+					},
+				},
+			},
+		},
+		{
+			name:  "QuantityEntry",
+			input: "timeout = 30s\nbuffer = 512KiB",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "timeout"},
+						Value: &Quantity{Value: 30e9, Unit: Duration, Text: "30s"},
+					},
+					{
+						Name:  &Ident{Value: "buffer"},
+						Value: &Quantity{Value: 512 << 10, Unit: Size, Text: "512KiB"},
+					},
+				},
+			},
+		},
+		{
+			name:  "RawAndHeredoc",
+			input: "a = `\\d+`\nb = <<-EOT\n    x\n    EOT",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "a"},
+						Value: &String{Value: `\d+`, Text: "`\\d+`", Kind: Raw},
+					},
+					{
+						Name:  &Ident{Value: "b"},
+						Value: &String{Value: "x\n", Text: "<<-EOT\n    x\n    EOT", Kind: Heredoc},
+					},
+				},
+			},
+		},
+		{
+			name:  "Labels",
+			input: `Service "prod" web {}`,
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name: &Ident{Value: "Service"},
+						Labels: []*Label{
+							{Value: "prod", Text: `"prod"`},
+							{Value: "web", Text: "web"},
+						},
+						Value: &Block{},
 					},
 				},
 			},
@@ -79,9 +141,9 @@ func TestParse(t *testing.T) {
 						Name: &Ident{Value: "poo"},
 						Value: &List{
 							Values: []Value{
-								&Number{Value: 1},
+								&Number{Value: 1, Text: "1", Integer: true},
 								&Bool{Value: false},
-								&String{Value: "hello"},
+								&String{Value: "hello", Text: `"hello"`},
 							},
 						},
 					},
@@ -109,7 +171,7 @@ func TestParse(t *testing.T) {
 						Name: &Ident{Value: "poo"},
 						Value: &List{
 							Values: []Value{
-								&Number{Value: 1},
+								&Number{Value: 1, Text: "1", Integer: true},
 							},
 						},
 					},
@@ -125,7 +187,7 @@ func TestParse(t *testing.T) {
 						Name: &Ident{Value: "poo"},
 						Value: &List{
 							Values: []Value{
-								&Number{Value: 1},
+								&Number{Value: 1, Text: "1", Integer: true},
 							},
 						},
 					},
@@ -155,7 +217,7 @@ func TestParse(t *testing.T) {
 							Entries: []*Entry{
 								{
 									Name:  &Ident{Value: "foo"},
-									Value: &Number{Value: 1},
+									Value: &Number{Value: 1, Text: "1", Integer: true},
 								},
 							},
 						},
@@ -174,11 +236,168 @@ func TestParse(t *testing.T) {
 							Entries: []*Entry{
 								{
 									Name:  &Ident{Value: "foo"},
-									Value: &Number{Value: 1},
+									Value: &Number{Value: 1, Text: "1", Integer: true},
 								},
 								{
 									Name:  &Ident{Value: "bar"},
-									Value: &Number{Value: 2},
+									Value: &Number{Value: 2, Text: "2", Integer: true},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "LeadingComment",
+			input: "// first\n// second\nfoo = 1",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "foo"},
+						Value: &Number{Value: 1, Text: "1", Integer: true},
+						Leading: &CommentGroup{
+							List: []*Comment{
+								{Text: "// first"},
+								{Text: "// second"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "TrailingComment",
+			input: "foo = 1 // one\nbar = 2",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "foo"},
+						Value: &Number{Value: 1, Text: "1", Integer: true},
+						Trailing: &CommentGroup{
+							List: []*Comment{{Text: "// one"}},
+						},
+					},
+					{
+						Name:  &Ident{Value: "bar"},
+						Value: &Number{Value: 2, Text: "2", Integer: true},
+					},
+				},
+			},
+		},
+		{
+			name:  "BlockComments",
+			input: "block { // open\nfoo = 1\n// footer\n} // close",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name: &Ident{Value: "block"},
+						Value: &Block{
+							Entries: []*Entry{
+								{
+									Name:  &Ident{Value: "foo"},
+									Value: &Number{Value: 1, Text: "1", Integer: true},
+									Leading: &CommentGroup{
+										List: []*Comment{{Text: "// open"}},
+									},
+								},
+							},
+							Footer: &CommentGroup{
+								List: []*Comment{{Text: "// footer"}},
+							},
+						},
+						Trailing: &CommentGroup{
+							List: []*Comment{{Text: "// close"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "Include",
+			input: "include \"services/*.conf\"\ninclude \"x\" {}",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name: &Ident{Value: "include"},
+						Value: &Include{
+							Path: &String{Value: "services/*.conf", Text: `"services/*.conf"`},
+						},
+					},
+					{
+						Name:   &Ident{Value: "include"},
+						Labels: []*Label{{Value: "x", Text: `"x"`}},
+						Value:  &Block{},
+					},
+				},
+			},
+		},
+		{
+			name:  "Reset",
+			input: "Allow = !reset",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "Allow"},
+						Value: &Reset{},
+					},
+				},
+			},
+		},
+		{
+			name:  "Null",
+			input: "a = null\nb = [null]",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name:  &Ident{Value: "a"},
+						Value: &Null{},
+					},
+					{
+						Name:  &Ident{Value: "b"},
+						Value: &List{Values: []Value{&Null{}}},
+					},
+				},
+			},
+		},
+		{
+			name:  "InlineObject",
+			input: "a = {b = 1, c {}}\nd = [{}, {\n  e = true\n  f = \"x\",\n}]",
+			expect: &Block{
+				Entries: []*Entry{
+					{
+						Name: &Ident{Value: "a"},
+						Value: &Block{
+							Inline: true,
+							Entries: []*Entry{
+								{
+									Name:  &Ident{Value: "b"},
+									Value: &Number{Value: 1, Text: "1", Integer: true},
+								},
+								{
+									Name:  &Ident{Value: "c"},
+									Value: &Block{},
+								},
+							},
+						},
+					},
+					{
+						Name: &Ident{Value: "d"},
+						Value: &List{
+							Values: []Value{
+								&Block{Inline: true},
+								&Block{
+									Inline: true,
+									Entries: []*Entry{
+										{
+											Name:  &Ident{Value: "e"},
+											Value: &Bool{Value: true},
+										},
+										{
+											Name:  &Ident{Value: "f"},
+											Value: &String{Value: "x", Text: `"x"`},
+										},
+									},
 								},
 							},
 						},
@@ -186,6 +405,15 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "OnlyComments",
+			input: "// nothing here\n",
+			expect: &Block{
+				Footer: &CommentGroup{
+					List: []*Comment{{Text: "// nothing here"}},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -202,6 +430,7 @@ func TestParseGolden(t *testing.T) {
 	}{
 		{"basic"},
 		{"nested"},
+		{"labels"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -214,3 +443,182 @@ func TestParseGolden(t *testing.T) {
 		})
 	}
 }
+
+func TestParseListComments(t *testing.T) {
+	input := `list = [
+		// leading
+		1, // one
+		2 // two
+		// footer
+	]`
+	block, err := Parse(input)
+	assert.NilError(t, err)
+	l := block.Entries[0].Value.(*List)
+	assert.Equal(t, len(l.Values), 2)
+	assert.Equal(t, l.Leading[l.Values[0]].Text(), "leading\n")
+	assert.Equal(t, l.Trailing[l.Values[0]].Text(), "one\n")
+	assert.Assert(t, l.Leading[l.Values[1]] == nil)
+	assert.Equal(t, l.Trailing[l.Values[1]].Text(), "two\n")
+	assert.Equal(t, l.Footer.Text(), "footer\n")
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text    string
+		value   float64
+		integer bool
+	}{
+		{"42", 42, true},
+		{"-1_000", -1000, true},
+		{"0x1F", 31, true},
+		{"0o755", 493, true},
+		{"0755", 493, true},
+		{"0b1010", 10, true},
+		{"1e3", 1000, false},
+		{".5", 0.5, false},
+		{"-inf", math.Inf(-1), false},
+		{"inf", math.Inf(1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			block, err := Parse("a = " + tt.text)
+			assert.NilError(t, err)
+			n := block.Entries[0].Value.(*Number)
+			assert.Equal(t, n.Value, tt.value)
+			assert.Equal(t, n.Integer, tt.integer)
+			assert.Equal(t, n.Text, tt.text)
+		})
+	}
+	block, err := Parse("a = nan")
+	assert.NilError(t, err)
+	assert.Assert(t, math.IsNaN(block.Entries[0].Value.(*Number).Value))
+}
+
+func TestParseValue(t *testing.T) {
+	v, err := ParseValue(" [1, 30s] ")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, v, &List{
+		Values: []Value{
+			&Number{Value: 1, Text: "1", Integer: true},
+			&Quantity{Value: 30e9, Unit: Duration, Text: "30s"},
+		},
+	}, cmpopts.IgnoreTypes(token.Pos{}))
+	_, err = ParseValue("1 2")
+	assert.Error(t, err, `1:3: unexpected token NUMBER("2")`)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		entries int
+		message string
+	}{
+		{
+			name:    "Recover",
+			input:   "a = 1\nb = \nc = 2\nd = @\ne = 3",
+			entries: 3,
+			message: "2:5: unexpected token NEWLINE(\"\")\n4:5: unexpected token INVALID(\"@\")",
+		},
+		{
+			name:    "NestedBlock",
+			input:   "a {\n  b = \n  c = [1, ]\n}\nd = 1",
+			entries: 2,
+			message: "2:7: unexpected token NEWLINE(\"\")",
+		},
+		{
+			name:    "UnmatchedBrace",
+			input:   "a = 1\n}\nb = 2",
+			entries: 2,
+			message: "2:1: unexpected token RBRACE(\"}\")",
+		},
+		{
+			name:    "UnclosedList",
+			input:   "a {\n  c = [1, }\n}\nd = 1",
+			entries: 2,
+			message: "2:11: unexpected token RBRACE(\"}\")\n3:1: unexpected token RBRACE(\"}\")",
+		},
+		{
+			name:    "RecoverList",
+			input:   "a = [\n  1,\n  foo,\n  2,\n  [3, @],\n  4\n]\nb = [\n  bar\n]\nc = 1",
+			entries: 3,
+			message: "3:3: unexpected token IDENT(\"foo\")\n5:7: unexpected token INVALID(\"@\")\n9:3: unexpected token IDENT(\"bar\")",
+		},
+		{
+			name:    "BadNumber",
+			input:   "a = 1.2.3\nb = 1",
+			entries: 1,
+			message: "1:5: unexpected token INVALID(\"1.2.3\")",
+		},
+		{
+			name:    "LabelledAssign",
+			input:   "a \"b\" = 1\nc = 1",
+			entries: 1,
+			message: "1:7: unexpected token ASSIGN(\"=\")",
+		},
+		{
+			name:    "BadInclude",
+			input:   "include foo\ninclude \"a\" \"b\"\nc = 1",
+			entries: 1,
+			message: "1:12: unexpected token NEWLINE(\"\")\n2:16: unexpected token NEWLINE(\"\")",
+		},
+		{
+			name:    "BadObject",
+			input:   "a = {b = 1 c = 2}\nd = {,}\ne = {f}\ng = 1",
+			entries: 4,
+			message: "1:12: unexpected token IDENT(\"c\")\n2:6: unexpected token COMMA(\",\")\n3:7: unexpected token RBRACE(\"}\")",
+		},
+		{
+			name:    "UnclosedObject",
+			input:   "a = {\n  b = 1,\n",
+			entries: 0,
+			message: "3:1: unexpected token EOF(\"\")",
+		},
+		{
+			name:    "BadEscape",
+			input:   "a = \"\\q\"\nb = 1",
+			entries: 1,
+			message: `1:5: invalid escape sequence: \q`,
+		},
+		{
+			name:    "BadNumberRange",
+			input:   "a = 1e400\nb = -1e400\nc = 1" + strings.Repeat("0", 400) + "\nd = 1",
+			entries: 2,
+			message: "1:5: number \"1e400\" is out of range\n2:5: number \"-1e400\" is out of range",
+		},
+		{
+			name:    "SignedNaN",
+			input:   "a = -nan\nb = +nan\nc = 1",
+			entries: 1,
+			message: "1:5: unexpected token INVALID(\"-nan\")\n2:5: unexpected token INVALID(\"+nan\")",
+		},
+		{
+			name:    "BadUnit",
+			input:   "a = 10xs\nb = 1",
+			entries: 1,
+			message: `1:5: invalid quantity "10xs"`,
+		},
+		{
+			name:    "UnclosedBlock",
+			input:   "a {\n b = 1\n",
+			entries: 0,
+			message: "3:1: unexpected token EOF(\"\")",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := Parse(tt.input)
+			assert.Error(t, err, tt.message)
+			assert.Equal(t, len(block.Entries), tt.entries)
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	filename := filepath.Join("testdata", "basic", "input.conf")
+	block, err := ParseFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, block.Start.Filename, filename)
+	inner := block.Entries[0].Value.(*Block)
+	assert.Equal(t, inner.Entries[0].Value.(*Number).Start.String(), filename+":3:12")
+}
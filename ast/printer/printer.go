@@ -0,0 +1,352 @@
+// Package printer implements printing of configuration ASTs in a canonical format.
+package printer
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/icholy/config/ast"
+)
+
+// indent is the string used to indent nested blocks and lists
+const indent = "    "
+
+// Format parses src and returns it in canonical format
+func Format(src []byte) ([]byte, error) {
+	block, err := ast.Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, block); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fprint writes the block to w in canonical format.
+// Comments and blank lines between entries are preserved.
+func Fprint(w io.Writer, b *ast.Block) error {
+	var p printer
+	p.entries(b.Entries, b.Footer, b.Start.Line, 0)
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// printer accumulates the formatted output
+type printer struct {
+	buf bytes.Buffer
+}
+
+// line starts a new line at the given depth
+func (p *printer) line(depth int) {
+	p.buf.WriteString(strings.Repeat(indent, depth))
+}
+
+// entries prints a sequence of entries followed by the footer comments.
+// The line is the source line the sequence starts on, it's used to detect blank lines.
+func (p *printer) entries(ee []*ast.Entry, footer *ast.CommentGroup, line, depth int) {
+	widths := alignment(ee)
+	first := true
+	for i, e := range ee {
+		if e.Leading != nil {
+			for _, c := range e.Leading.List {
+				p.blank(first, line, c.Start.Line)
+				p.comment(c, depth)
+				line = c.Start.Line
+				first = false
+			}
+		}
+		p.blank(first, line, e.Start.Line)
+		p.line(depth)
+		p.entry(e, widths[i], depth)
+		line = endLine(e)
+		first = false
+	}
+	if footer != nil {
+		for _, c := range footer.List {
+			p.blank(first, line, c.Start.Line)
+			p.comment(c, depth)
+			line = c.Start.Line
+			first = false
+		}
+	}
+}
+
+// blank prints an empty line if there was at least one in the source
+// between the prev and next lines. Blank lines are never printed first.
+func (p *printer) blank(first bool, prev, next int) {
+	if !first && next > prev+1 {
+		p.buf.WriteString("\n")
+	}
+}
+
+// comment prints a comment on its own line
+func (p *printer) comment(c *ast.Comment, depth int) {
+	p.line(depth)
+	p.buf.WriteString(c.Text)
+	p.buf.WriteString("\n")
+}
+
+// entry prints a single entry. The name is padded to width.
+func (p *printer) entry(e *ast.Entry, width, depth int) {
+	p.buf.WriteString(e.Name.Value)
+	for _, l := range e.Labels {
+		p.buf.WriteString(" ")
+		p.buf.WriteString(l.Text)
+	}
+	switch v := e.Value.(type) {
+	case *ast.Block:
+		if v.Inline {
+			p.assign(e, width, depth)
+			break
+		}
+		p.buf.WriteString(" ")
+		p.block(v, depth)
+	case *ast.Include:
+		p.buf.WriteString(" ")
+		p.value(v.Path, depth)
+	default:
+		p.assign(e, width, depth)
+	}
+	p.trailing(e.Trailing)
+	p.buf.WriteString("\n")
+}
+
+// assign prints the value of an assignment. The name is padded to width.
+func (p *printer) assign(e *ast.Entry, width, depth int) {
+	if pad := width - len(e.Name.Value); pad > 0 {
+		p.buf.WriteString(strings.Repeat(" ", pad))
+	}
+	p.buf.WriteString(" = ")
+	p.value(e.Value, depth)
+}
+
+// trailing prints a trailing comment
+func (p *printer) trailing(g *ast.CommentGroup) {
+	if g == nil {
+		return
+	}
+	for _, c := range g.List {
+		p.buf.WriteString(" ")
+		p.buf.WriteString(c.Text)
+	}
+}
+
+// block prints a block starting at the opening brace
+func (p *printer) block(b *ast.Block, depth int) {
+	if len(b.Entries) == 0 && b.Footer == nil {
+		p.buf.WriteString("{}")
+		return
+	}
+	p.buf.WriteString("{\n")
+	p.entries(b.Entries, b.Footer, b.Start.Line, depth+1)
+	p.line(depth)
+	p.buf.WriteString("}")
+}
+
+// object prints an inline block which fits on a single line
+func (p *printer) object(b *ast.Block, depth int) {
+	p.buf.WriteString("{")
+	for i, e := range b.Entries {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.buf.WriteString(e.Name.Value)
+		for _, l := range e.Labels {
+			p.buf.WriteString(" ")
+			p.buf.WriteString(l.Text)
+		}
+		if v, ok := e.Value.(*ast.Block); ok && !v.Inline {
+			p.buf.WriteString(" ")
+			p.object(v, depth)
+		} else {
+			p.buf.WriteString(" = ")
+			p.value(e.Value, depth)
+		}
+	}
+	p.buf.WriteString("}")
+}
+
+// list prints a list. Lists which spanned multiple lines or
+// contain comments are printed with one value per line.
+func (p *printer) list(l *ast.List, depth int) {
+	if !multiline(l) {
+		p.buf.WriteString("[")
+		for i, v := range l.Values {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.value(v, depth)
+		}
+		p.buf.WriteString("]")
+		return
+	}
+	p.buf.WriteString("[\n")
+	for _, v := range l.Values {
+		if g := l.Leading[v]; g != nil {
+			for _, c := range g.List {
+				p.comment(c, depth+1)
+			}
+		}
+		p.line(depth + 1)
+		p.value(v, depth+1)
+		p.buf.WriteString(",")
+		p.trailing(l.Trailing[v])
+		p.buf.WriteString("\n")
+	}
+	if l.Footer != nil {
+		for _, c := range l.Footer.List {
+			p.comment(c, depth+1)
+		}
+	}
+	p.line(depth)
+	p.buf.WriteString("]")
+}
+
+// value prints a value
+func (p *printer) value(v ast.Value, depth int) {
+	switch v := v.(type) {
+	case *ast.Block:
+		if oneline(v) {
+			p.object(v, depth)
+		} else {
+			p.block(v, depth)
+		}
+	case *ast.List:
+		p.list(v, depth)
+	case *ast.Number:
+		if v.Text != "" {
+			p.buf.WriteString(v.Text)
+		} else {
+			p.buf.WriteString(strconv.FormatFloat(v.Value, 'f', -1, 64))
+		}
+	case *ast.Quantity:
+		p.buf.WriteString(v.Text)
+	case *ast.String:
+		if v.Kind == ast.Heredoc && strings.HasPrefix(v.Text, "<<-") {
+			p.heredoc(v, depth)
+		} else if v.Text != "" {
+			p.buf.WriteString(v.Text)
+		} else {
+			p.buf.WriteString(strconv.Quote(v.Value))
+		}
+	case *ast.Bool:
+		p.buf.WriteString(strconv.FormatBool(v.Value))
+	case *ast.Null:
+		p.buf.WriteString("null")
+	case *ast.Reset:
+		p.buf.WriteString("!reset")
+	}
+}
+
+// heredoc prints an indented heredoc. The body is re-indented one level
+// deeper than the entry and the closing marker is aligned with the entry.
+func (p *printer) heredoc(s *ast.String, depth int) {
+	header := strings.TrimRight(strings.SplitN(s.Text, "\n", 2)[0], "\r")
+	p.buf.WriteString(header)
+	p.buf.WriteString("\n")
+	if s.Value != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(s.Value, "\n"), "\n") {
+			if line != "" {
+				p.line(depth + 1)
+				p.buf.WriteString(line)
+			}
+			p.buf.WriteString("\n")
+		}
+	}
+	p.line(depth)
+	p.buf.WriteString(strings.TrimPrefix(header, "<<-"))
+}
+
+// multiline returns true if the list must be printed on multiple lines
+func multiline(l *ast.List) bool {
+	return l.Start.Line != l.Stop.Line || len(l.Leading) > 0 || len(l.Trailing) > 0 || l.Footer != nil
+}
+
+// oneline returns true if the block is an inline block which was written on a single line
+func oneline(b *ast.Block) bool {
+	return b.Inline && b.Start.Line == b.Stop.Line
+}
+
+// alignment returns the width each entry name should be padded to so that
+// the = signs of consecutive single line assignments line up.
+// Blank lines, blocks, and multi-line values end a section.
+func alignment(ee []*ast.Entry) []int {
+	widths := make([]int, len(ee))
+	start := 0
+	flush := func(end int) {
+		max := 0
+		for _, e := range ee[start:end] {
+			if n := len(e.Name.Value); n > max {
+				max = n
+			}
+		}
+		for i := start; i < end; i++ {
+			widths[i] = max
+		}
+		start = end
+	}
+	for i, e := range ee {
+		if !alignable(e) {
+			flush(i)
+			start = i + 1
+			continue
+		}
+		if i > start && firstLine(e) > endLine(ee[i-1])+1 {
+			flush(i)
+		}
+	}
+	flush(len(ee))
+	return widths
+}
+
+// alignable returns true if the entry is an assignment which fits on a single line
+func alignable(e *ast.Entry) bool {
+	switch v := e.Value.(type) {
+	case *ast.Block:
+		return oneline(v)
+	case *ast.Include:
+		return false
+	case *ast.List:
+		return !multiline(v)
+	default:
+		return true
+	}
+}
+
+// firstLine returns the first source line of an entry including its leading comments
+func firstLine(e *ast.Entry) int {
+	if e.Leading != nil && len(e.Leading.List) > 0 {
+		return e.Leading.List[0].Start.Line
+	}
+	return e.Start.Line
+}
+
+// endLine returns the last source line of an entry
+func endLine(e *ast.Entry) int {
+	switch v := e.Value.(type) {
+	case *ast.Block:
+		return v.Stop.Line
+	case *ast.List:
+		return v.Stop.Line
+	case *ast.Number:
+		return v.Stop.Line
+	case *ast.Quantity:
+		return v.Stop.Line
+	case *ast.String:
+		return v.Stop.Line
+	case *ast.Bool:
+		return v.Stop.Line
+	case *ast.Include:
+		return v.Stop.Line
+	case *ast.Null:
+		return v.Stop.Line
+	case *ast.Reset:
+		return v.Stop.Line
+	default:
+		return e.Start.Line
+	}
+}
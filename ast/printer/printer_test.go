@@ -0,0 +1,29 @@
+package printer
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{"basic"},
+		{"comments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := golden.Get(t, tt.name+".input")
+			output, err := Format(input)
+			assert.NilError(t, err)
+			golden.Assert(t, string(output), tt.name+".golden")
+			// formatting must be idempotent
+			again, err := Format(output)
+			assert.NilError(t, err)
+			assert.Equal(t, string(again), string(output))
+		})
+	}
+}
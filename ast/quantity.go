@@ -0,0 +1,79 @@
+package ast
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Unit is the kind of a Quantity
+type Unit int
+
+const (
+	// Duration quantities, like 30s, are measured in nanoseconds
+	Duration Unit = iota + 1
+	// Size quantities, like 512KiB, are measured in bytes
+	Size
+)
+
+// String returns the name of the unit
+func (u Unit) String() string {
+	switch u {
+	case Duration:
+		return "duration"
+	case Size:
+		return "size"
+	default:
+		return fmt.Sprintf("Unit(%d)", int(u))
+	}
+}
+
+// sizes maps size suffixes to their number of bytes
+var sizes = map[string]int64{
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"PB":  1e15,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+	"PiB": 1 << 50,
+}
+
+// ParseQuantity parses a number followed by a unit.
+// Durations use the time.ParseDuration syntax and sizes
+// use the decimal (KB, MB, ...) and binary (KiB, MiB, ...) suffixes.
+// Digits can be separated by underscores, and sizes must be a whole
+// number of bytes.
+func ParseQuantity(text string) (int64, Unit, error) {
+	s := strings.ReplaceAll(text, "_", "")
+	i := strings.IndexFunc(s, func(ch rune) bool {
+		return !('0' <= ch && ch <= '9') && ch != '.' && ch != '-' && ch != '+'
+	})
+	if i > 0 {
+		if mult, ok := sizes[s[i:]]; ok {
+			// exact arithmetic, so 1.1KB is 1100 bytes
+			r, ok := new(big.Rat).SetString(s[:i])
+			if !ok {
+				return 0, 0, fmt.Errorf("invalid size %q", text)
+			}
+			r.Mul(r, new(big.Rat).SetInt64(mult))
+			if !r.IsInt() {
+				return 0, 0, fmt.Errorf("size %q is not a whole number of bytes", text)
+			}
+			if !r.Num().IsInt64() {
+				return 0, 0, fmt.Errorf("size %q out of range", text)
+			}
+			return r.Num().Int64(), Size, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quantity %q", text)
+	}
+	return int64(d), Duration, nil
+}
@@ -0,0 +1,47 @@
+package ast
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		text  string
+		value int64
+		unit  Unit
+		err   string
+	}{
+		{text: "30s", value: int64(30 * time.Second), unit: Duration},
+		{text: "1h30m", value: int64(90 * time.Minute), unit: Duration},
+		{text: "-1.5ms", value: int64(-1500 * time.Microsecond), unit: Duration},
+		{text: "500µs", value: int64(500 * time.Microsecond), unit: Duration},
+		{text: "10B", value: 10, unit: Size},
+		{text: "10MB", value: 10e6, unit: Size},
+		{text: "512KiB", value: 512 << 10, unit: Size},
+		{text: "1.5GiB", value: 3 << 29, unit: Size},
+		{text: "1_000s", value: int64(1000 * time.Second), unit: Duration},
+		{text: "1_000MB", value: 1e9, unit: Size},
+		{text: "1.1KB", value: 1100, unit: Size},
+		{text: "0.5KB", value: 500, unit: Size},
+		{text: "0.5B", err: `size "0.5B" is not a whole number of bytes`},
+		{text: "1.0001KB", err: `size "1.0001KB" is not a whole number of bytes`},
+		{text: "10mb", err: `invalid quantity "10mb"`},
+		{text: "1.2.3KB", err: `invalid size "1.2.3KB"`},
+		{text: "9000PiB", err: `size "9000PiB" out of range`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			value, unit, err := ParseQuantity(tt.text)
+			if tt.err != "" {
+				assert.Error(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, value, tt.value)
+			assert.Equal(t, unit, tt.unit)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package ast
+
+import "fmt"
+
+// Visitor's Visit method is called for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order. It starts by calling
+// v.Visit(node), node must not be nil. The children of an entry are
+// visited in order: its name, labels, and value.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Block:
+		for _, e := range n.Entries {
+			Walk(v, e)
+		}
+	case *Entry:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		for _, l := range n.Labels {
+			Walk(v, l)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *List:
+		for _, x := range n.Values {
+			Walk(v, x)
+		}
+	case *Include:
+		if n.Path != nil {
+			Walk(v, n.Path)
+		}
+	case *Ident, *Label, *Number, *Quantity, *Bool, *String, *Null, *Reset:
+		// nothing to do
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order. It starts by calling
+// f(node), node must not be nil. If f returns true, Inspect calls f
+// recursively for each of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,110 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// dump returns the tree as indented lines, one per node
+func dump(root Node) string {
+	var b strings.Builder
+	depth := 0
+	Inspect(root, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		b.WriteString(strings.Repeat("  ", depth))
+		switch n := n.(type) {
+		case *Ident:
+			fmt.Fprintf(&b, "Ident %s", n.Value)
+		case *Label:
+			fmt.Fprintf(&b, "Label %s", n.Text)
+		case *Number:
+			fmt.Fprintf(&b, "Number %s", n.Text)
+		case *String:
+			fmt.Fprintf(&b, "String %s", n.Text)
+		case *Bool:
+			fmt.Fprintf(&b, "Bool %t", n.Value)
+		default:
+			fmt.Fprintf(&b, "%T", n)
+		}
+		fmt.Fprintf(&b, " %s-%s\n", n.Pos(), n.End())
+		depth++
+		return true
+	})
+	return b.String()
+}
+
+func TestInspect(t *testing.T) {
+	input := strings.Join([]string{
+		`a = 1`,
+		`b "x" {`,
+		`  c = [true, null]`,
+		`}`,
+		`include "d.conf"`,
+	}, "\n")
+	block, err := Parse(input)
+	assert.NilError(t, err)
+	assert.Equal(t, dump(block), strings.Join([]string{
+		`*ast.Block 1:1-5:17`,
+		`  *ast.Entry 1:1-1:6`,
+		`    Ident a 1:1-1:2`,
+		`    Number 1 1:5-1:6`,
+		`  *ast.Entry 2:1-4:2`,
+		`    Ident b 2:1-2:2`,
+		`    Label "x" 2:3-2:6`,
+		`    *ast.Block 2:7-4:2`,
+		`      *ast.Entry 3:3-3:19`,
+		`        Ident c 3:3-3:4`,
+		`        *ast.List 3:7-3:19`,
+		`          Bool true 3:8-3:12`,
+		`          *ast.Null 3:14-3:18`,
+		`  *ast.Entry 5:1-5:17`,
+		`    Ident include 5:1-5:8`,
+		`    *ast.Include 5:1-5:17`,
+		`      String "d.conf" 5:9-5:17`,
+		``,
+	}, "\n"))
+
+	// children are skipped when f returns false
+	var names []string
+	Inspect(block, func(n Node) bool {
+		if e, ok := n.(*Entry); ok {
+			names = append(names, e.Name.Value)
+			return e.Name.Value != "b"
+		}
+		return true
+	})
+	assert.DeepEqual(t, names, []string{"a", "b", "include"})
+}
+
+type countVisitor map[string]int
+
+func (v countVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		v["nil"]++
+		return nil
+	}
+	v[fmt.Sprintf("%T", n)]++
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	block, err := Parse("a = [1, 2]\nb {\n  c = `x`\n}")
+	assert.NilError(t, err)
+	v := countVisitor{}
+	Walk(v, block)
+	assert.DeepEqual(t, v, countVisitor{
+		"*ast.Block":  2,
+		"*ast.Entry":  3,
+		"*ast.Ident":  3,
+		"*ast.List":   1,
+		"*ast.Number": 2,
+		"*ast.String": 1,
+		"nil":         12,
+	})
+}
@@ -0,0 +1,135 @@
+// Command configfmt formats configuration files.
+//
+// Usage:
+//
+//	configfmt [flags] [path ...]
+//
+// Without paths, it formats standard input. Directories are
+// walked recursively for files ending in .conf.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/icholy/config/ast/printer"
+)
+
+var (
+	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	list  = flag.Bool("l", false, "list files whose formatting differs from configfmt's")
+	diff  = flag.Bool("d", false, "display diffs instead of rewriting files")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: configfmt [flags] [path ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		if *write {
+			fatalf("cannot use -w with standard input")
+		}
+		if err := process("<standard input>", os.Stdin, os.Stdout); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	var failed bool
+	for _, path := range flag.Args() {
+		err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (name != path && filepath.Ext(name) != ".conf") {
+				return nil
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return process(name, f, os.Stdout)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(2)
+	}
+}
+
+// process formats a single file according to the flags
+func process(name string, r io.Reader, w io.Writer) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	res, err := printer.Format(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	changed := !bytes.Equal(src, res)
+	if *list && changed {
+		fmt.Fprintln(w, name)
+	}
+	if *write && changed {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if *diff && changed {
+		data, err := unifiedDiff(name, src, res)
+		if err != nil {
+			return fmt.Errorf("computing diff: %w", err)
+		}
+		fmt.Fprintf(w, "diff -u %s.orig %s\n", name, name)
+		w.Write(data)
+	}
+	if !*list && !*write && !*diff {
+		_, err = w.Write(res)
+	}
+	return err
+}
+
+// unifiedDiff returns the output of diff -u for the two inputs
+func unifiedDiff(name string, a, b []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "configfmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Base(name)
+	orig := filepath.Join(dir, base+".orig")
+	formatted := filepath.Join(dir, base)
+	if err := os.WriteFile(orig, a, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(formatted, b, 0o644); err != nil {
+		return nil, err
+	}
+	data, err := exec.Command("diff", "-u", orig, formatted).Output()
+	if len(data) > 0 {
+		// diff exits with status 1 when the files differ
+		return data, nil
+	}
+	return data, err
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "configfmt: "+format+"\n", args...)
+	os.Exit(2)
+}
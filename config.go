@@ -1,19 +1,280 @@
 package config
 
 import (
+	"encoding"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/icholy/config/ast"
+	"github.com/icholy/config/token"
 )
 
 // Unmarshal ...
 func Unmarshal(data []byte, v interface{}) error {
-	block, err := ast.Parse(string(data))
+	var d Decoder
+	return d.Unmarshal(data, v)
+}
+
+// Unmarshaler is implemented by types which decode their own configuration
+type Unmarshaler interface {
+	UnmarshalConfig(ast.Value) error
+}
+
+// Defaulter is implemented by types which set their own default values.
+// SetDefaults is called before a block is decoded into the value.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// DecodeFunc decodes an ast value into dst
+type DecodeFunc func(v ast.Value, dst reflect.Value) error
+
+// DecodeFile decodes the named file into the value pointed to by v.
+// Error positions include the file name. Include directives are read
+// from the operating system's file system.
+func DecodeFile(path string, v interface{}) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	return decodeBlock(block, reflect.ValueOf(v), false)
+	defer f.Close()
+	d := NewDecoder(f)
+	d.IncludeFS(osFS{})
+	return d.Decode(v)
+}
+
+// DecodeFS is like DecodeFile but the file, and the files it includes, are read from fsys
+func DecodeFS(fsys fs.FS, name string, v interface{}) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	d.filename = name
+	d.IncludeFS(fsys)
+	return d.Decode(v)
+}
+
+// DecodeFiles merges the named files with Merge and decodes the result into
+// the value pointed to by v. Later files take precedence.
+func DecodeFiles(paths []string, v interface{}) error {
+	var d Decoder
+	return d.DecodeFiles(paths, v)
+}
+
+// osFS is a file system which opens paths with the os package
+type osFS struct{}
+
+// Open implements fs.FS
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+// Decoder decodes configuration into Go values.
+// The zero value is ready to use with Unmarshal.
+type Decoder struct {
+	r            io.Reader
+	filename     string
+	decoders     map[reflect.Type]DecodeFunc
+	limit        int
+	allowUnknown bool
+	aliases      bool
+	validate     bool
+	lookup       LookupFunc
+	fsys         fs.FS
+	merger       Merger
+	meta         Metadata
+	// positions maps pointers to the decoded values to the ast values they were decoded from
+	positions map[interface{}]ast.Value
+	// entryPositions holds the positions of the values inside map values.
+	// Map values are decoded into a copy, so they're relative to its start.
+	entryPositions map[mapEntry]map[offset]ast.Value
+}
+
+// mapEntry identifies a value in a map
+type mapEntry struct {
+	m   uintptr // the map's pointer
+	key interface{}
+}
+
+// offset identifies a value inside a map value
+type offset struct {
+	n   uintptr      // from the start of the map value
+	typ reflect.Type // a pointer type, a struct and its first field have the same offset
+}
+
+// within returns the offset of addr from base, if it's inside the size bytes starting at base
+func within(addr, base, size uintptr) (uintptr, bool) {
+	n := addr - base
+	return n, addr >= base && (n < size || n == 0)
+}
+
+// NewDecoder returns a decoder which reads from r.
+// If r has a Name method, like *os.File, it's used as the file name in error positions
+// and includes are resolved relative to it. It's converted to a slash-separated path.
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{r: r}
+	if n, ok := r.(interface{ Name() string }); ok {
+		d.filename = filepath.ToSlash(n.Name())
+	}
+	return d
+}
+
+// ErrorList is a list of errors sorted by position.
+// Parse and decode errors are returned as an ErrorList.
+type ErrorList = token.ErrorList
+
+// ErrorLimit sets the maximum number of errors returned.
+// A limit of zero means there is no limit.
+func (d *Decoder) ErrorLimit(n int) {
+	d.limit = n
+}
+
+// DisallowUnknownFields controls whether entries which don't match
+// a struct field cause an error. It's enabled by default. When disabled,
+// the unknown keys are reported by Metadata instead.
+func (d *Decoder) DisallowUnknownFields(disallow bool) {
+	d.allowUnknown = !disallow
+}
+
+// MatchAliases controls whether entries can use the snake_case and lowerCamel
+// forms of untagged field names, e.g. max_conns or maxConns for MaxConns.
+// It's disabled by default.
+func (d *Decoder) MatchAliases(match bool) {
+	d.aliases = match
+}
+
+// ValidateOnDecode controls whether decoded values are validated.
+// See Validate for details.
+func (d *Decoder) ValidateOnDecode(validate bool) {
+	d.validate = validate
+}
+
+// IncludeFS enables include directives. Included files are read from fsys
+// and relative paths are resolved from the directory of the including file.
+// The top level file's name is taken from the decoder's reader, if it doesn't
+// have one, paths are resolved from the root of fsys. See ast.ExpandIncludes.
+func (d *Decoder) IncludeFS(fsys fs.FS) {
+	d.fsys = fsys
+}
+
+// MergeStrategy sets the strategy DecodeFiles uses for the key path.
+// The empty path sets the strategy for the keys without one.
+func (d *Decoder) MergeStrategy(path string, s MergeStrategy) {
+	if path == "" {
+		d.merger.Strategy = s
+		return
+	}
+	if d.merger.Keys == nil {
+		d.merger.Keys = map[string]MergeStrategy{}
+	}
+	d.merger.Keys[path] = s
+}
+
+// Metadata returns the keys seen by the most recent decode
+func (d *Decoder) Metadata() Metadata {
+	return d.meta
+}
+
+// RegisterDecoder registers a function for decoding values of type t.
+// Registered decoders take precedence over Unmarshaler and encoding.TextUnmarshaler.
+func (d *Decoder) RegisterDecoder(t reflect.Type, fn DecodeFunc) {
+	if d.decoders == nil {
+		d.decoders = map[reflect.Type]DecodeFunc{}
+	}
+	d.decoders[t] = fn
+}
+
+// Unmarshal parses data and stores the result in the value pointed to by v
+func (d *Decoder) Unmarshal(data []byte, v interface{}) error {
+	block, err := ast.Parse(string(data))
+	if err != nil {
+		return d.errors(err)
+	}
+	return d.decode(block, v)
+}
+
+// Decode reads the configuration from the decoder's reader and
+// stores the result in the value pointed to by v
+func (d *Decoder) Decode(v interface{}) error {
+	if d.r == nil {
+		return fmt.Errorf("config: Decode called on decoder without a reader")
+	}
+	block, err := ast.ParseReader(d.filename, d.r)
+	if err != nil {
+		return d.errors(err)
+	}
+	return d.decode(block, v)
+}
+
+// DecodeFiles parses the named files, merges them, and stores the result in
+// the value pointed to by v. Later files take precedence, see MergeStrategy.
+// Included files are read from the IncludeFS file system, or the operating
+// system's if there isn't one.
+func (d *Decoder) DecodeFiles(paths []string, v interface{}) error {
+	fsys := d.fsys
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	var errs ErrorList
+	blocks := make([]*ast.Block, 0, len(paths))
+	for _, path := range paths {
+		b, err := ast.ParseFS(fsys, filepath.ToSlash(path))
+		errs.Add(err)
+		if b != nil {
+			blocks = append(blocks, b)
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return d.errors(err)
+	}
+	return d.decode(d.merger.Merge(blocks...), v)
+}
+
+// decode stores the block in the value pointed to by v
+func (d *Decoder) decode(block *ast.Block, v interface{}) error {
+	d.meta = Metadata{}
+	d.positions = map[interface{}]ast.Value{}
+	d.entryPositions = map[mapEntry]map[offset]ast.Value{}
+	if err := ast.ExpandIncludes(d.fsys, d.filename, block); err != nil {
+		return d.errors(err)
+	}
+	if d.lookup != nil {
+		if err := interpolateBlock(block, d.lookup); err != nil {
+			return d.errors(err)
+		}
+	}
+	return d.decodeAt(block, v, "")
+}
+
+// decodeAt stores the ast value, found at the key path, in the value pointed to by v
+func (d *Decoder) decodeAt(val ast.Value, v interface{}, path string) error {
+	err := d.decodeValue(val, reflect.ValueOf(v), path, false)
+	d.meta.sort()
+	if err == nil && d.validate {
+		err = d.validateAt(v, path)
+	}
+	return d.errors(err)
+}
+
+// errors converts err into a sorted ErrorList and applies the limit
+func (d *Decoder) errors(err error) error {
+	var list ErrorList
+	list.Add(err)
+	if err := list.Err(); err != nil {
+		return list.Truncate(d.limit)
+	}
+	return nil
 }
 
 func byName(ee []*ast.Entry) map[string][]*ast.Entry {
@@ -24,7 +285,20 @@ func byName(ee []*ast.Entry) map[string][]*ast.Entry {
 	return groups
 }
 
-func decodeBlock(b *ast.Block, dst reflect.Value, multi bool) error {
+// joinPath appends a key to the path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexPath appends an index to the path
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func (d *Decoder) decodeBlock(b *ast.Block, dst reflect.Value, path string, multi bool) error {
 	dst, update := realise(dst, func() reflect.Value {
 		if multi {
 			return reflect.ValueOf([]map[string]interface{}{})
@@ -36,8 +310,17 @@ func decodeBlock(b *ast.Block, dst reflect.Value, multi bool) error {
 		if dst.IsNil() {
 			dst.Set(reflect.MakeMap(dst.Type()))
 		}
+		var errs ErrorList
 		for name, entries := range byName(b.Entries) {
-			key := reflect.ValueOf(name)
+			key, err := mapKey(name, dst.Type().Key())
+			if err != nil {
+				errs.Add(keyError(entries[0], path, err))
+				continue
+			}
+			if rest, reset := afterReset(entries); reset && len(rest) == 0 {
+				dst.SetMapIndex(key, reflect.Value{})
+				continue
+			}
 			val := dst.MapIndex(key)
 			// make an addressable copy of val
 			var tmp reflect.Value
@@ -47,93 +330,713 @@ func decodeBlock(b *ast.Block, dst reflect.Value, multi bool) error {
 			} else {
 				tmp = reflect.New(dst.Type().Elem()).Elem()
 			}
-			for _, e := range entries {
-				if err := decodeValue(e.Value, tmp, len(entries) > 1); err != nil {
-					return err
-				}
-			}
-			dst.SetMapIndex(key, tmp)
+			errs.Add(d.setMapIndex(dst, key, tmp, func() error {
+				return d.decodeEntries(entries, tmp, joinPath(path, name))
+			}))
 		}
-		return nil
+		return errs.Err()
 	case reflect.Struct:
+		setDefaults(dst)
+		fields := cachedFields(dst.Type())
+		var errs ErrorList
+		seen := map[string]bool{}
 		for name, entries := range byName(b.Entries) {
-			field, ok := dst.Type().FieldByName(name)
+			f, ok := fields.byName(name, d.aliases)
 			if !ok {
-				return fmt.Errorf("no matching field: %q", name)
+				if d.allowUnknown {
+					for _, e := range entries {
+						d.meta.Unused = append(d.meta.Unused, Key{
+							Path: joinPath(path, name),
+							Pos:  e.Name.Start,
+						})
+					}
+					continue
+				}
+				errs.Add(keyError(entries[0], path, fmt.Errorf("no matching field: %q", name)))
+				continue
 			}
-			if field.Anonymous {
-				return fmt.Errorf("anonymous fields are not supported: %q", name)
+			if len(f.conflicts) > 0 {
+				errs.Add(keyError(entries[0], path, fmt.Errorf("ambiguous key %q matches %s", name, strings.Join(f.conflicts, " and "))))
+				continue
 			}
-			idx := field.Index[0]
-			for _, e := range entries {
-				if err := decodeValue(e.Value, dst.Field(idx), len(entries) > 1); err != nil {
-					return err
-				}
+			seen[f.name] = true
+			fv := fieldByIndex(dst, f.index)
+			errs.Add(d.decodeEntries(entries, fv, joinPath(path, name)))
+		}
+		errs.Add(d.defaults(b, dst, path, seen))
+		return errs.Err()
+	case reflect.Slice:
+		s := grow(dst)
+		if err := d.decodeValue(b, s.Index(s.Len()-1), path, multi); err != nil {
+			return err
+		}
+		update(s)
+		return nil
+	default:
+		return typeError(b, dst, path)
+	}
+}
+
+// defaults sets the fields which weren't in the block to the value of their
+// default tag and reports missing required fields. Fields are only set if they're
+// zero. Nested structs which weren't in the block have their defaults set too,
+// SetDefaults is called on them first, then they're called with a nil seen map
+// and required fields aren't checked.
+func (d *Decoder) defaults(b *ast.Block, dst reflect.Value, path string, seen map[string]bool) error {
+	var errs ErrorList
+	for _, f := range cachedFields(dst.Type()) {
+		if f.label || seen[f.name] || len(f.conflicts) > 0 {
+			continue
+		}
+		if f.required && seen != nil {
+			errs.Add(requiredError(b, path, f.name))
+			continue
+		}
+		if fv, ok := fieldByIndexNoAlloc(dst, f.index); ok && !fv.IsZero() {
+			continue
+		}
+		p := joinPath(path, f.name)
+		switch {
+		case f.hasDefault:
+			err := f.defErr
+			if err == nil {
+				err = d.decodeValue(f.defValue, fieldByIndex(dst, f.index), p, false)
+			}
+			if err != nil {
+				errs.Add(defaultError(b, p, f, err))
+			}
+		case f.typ.Kind() == reflect.Struct && !d.custom(f.typ) && hasDefaults(f.typ):
+			fv := fieldByIndex(dst, f.index)
+			setDefaults(fv)
+			errs.Add(d.defaults(b, fv, p, nil))
+		}
+	}
+	return errs.Err()
+}
+
+// setDefaults calls SetDefaults if v is addressable and implements Defaulter
+func setDefaults(v reflect.Value) {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(Defaulter); ok {
+			u.SetDefaults()
+		}
+	}
+}
+
+// decodeEntries decodes entries sharing the same name into dst.
+// Blocks with the same labels are reported as duplicates.
+func (d *Decoder) decodeEntries(entries []*ast.Entry, dst reflect.Value, path string) error {
+	entries, reset := afterReset(entries)
+	if reset {
+		dst.Set(reflect.Zero(dst.Type()))
+	}
+	if dst.Kind() == reflect.Array && !d.custom(dst.Type()) && unlabelledBlocks(entries) {
+		return d.decodeArray(entries, dst, path)
+	}
+	multi := len(entries) > 1
+	if multi {
+		reserve(dst, len(entries))
+	}
+	var errs ErrorList
+	seen := map[string]*ast.Entry{}
+	for i, e := range entries {
+		p := path
+		if len(e.Labels) > 0 {
+			p = labelPath(path, e.Labels)
+			if prev, ok := seen[p]; ok {
+				errs.Add(duplicateError(e, prev, path))
+				continue
 			}
+			seen[p] = e
+		} else if multi {
+			p = indexPath(path, i)
 		}
+		d.meta.Keys = append(d.meta.Keys, Key{Path: p, Pos: e.Name.Start})
+		if b, ok := e.Value.(*ast.Block); ok {
+			errs.Add(d.decodeLabels(e.Labels, b, dst, p, multi))
+		} else {
+			errs.Add(d.decodeValue(e.Value, dst, p, multi))
+		}
+	}
+	return errs.Err()
+}
+
+// decodeArray decodes repeated blocks into the elements of an array.
+// There must be one block for each element.
+func (d *Decoder) decodeArray(entries []*ast.Entry, dst reflect.Value, path string) error {
+	if len(entries) != dst.Len() {
+		return keyError(entries[0], path, fmt.Errorf("expecting %d blocks, got %d", dst.Len(), len(entries)))
+	}
+	var errs ErrorList
+	for i, e := range entries {
+		p := indexPath(path, i)
+		d.meta.Keys = append(d.meta.Keys, Key{Path: p, Pos: e.Name.Start})
+		errs.Add(d.decodeValue(e.Value, dst.Index(i), p, false))
+	}
+	return errs.Err()
+}
+
+// unlabelledBlocks returns true if there are entries and they're all blocks without labels
+func unlabelledBlocks(entries []*ast.Entry) bool {
+	for _, e := range entries {
+		if _, ok := e.Value.(*ast.Block); !ok || len(e.Labels) > 0 {
+			return false
+		}
+	}
+	return len(entries) > 0
+}
+
+// setMapIndex calls decode, which decodes into the addressable copy tmp, and stores
+// tmp in the map if it succeeds. The positions recorded inside tmp are moved to
+// entryPositions so they're still found after tmp is copied into the map.
+func (d *Decoder) setMapIndex(m, key, tmp reflect.Value, decode func() error) error {
+	if d.positions == nil {
+		if err := decode(); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, tmp)
 		return nil
+	}
+	outer := d.positions
+	d.positions = map[interface{}]ast.Value{}
+	err := decode()
+	inner := d.positions
+	d.positions = outer
+	if err != nil {
+		return err
+	}
+	entry := mapEntry{m: m.Pointer(), key: key.Interface()}
+	rel, ok := d.entryPositions[entry]
+	if !ok {
+		rel = map[offset]ast.Value{}
+		d.entryPositions[entry] = rel
+	}
+	base, size := tmp.Addr().Pointer(), tmp.Type().Size()
+	for ptr, node := range inner {
+		p := reflect.ValueOf(ptr)
+		if n, ok := within(p.Pointer(), base, size); ok {
+			rel[offset{n: n, typ: p.Type()}] = node
+		} else {
+			// pointers inside tmp point outside of it
+			outer[ptr] = node
+		}
+	}
+	m.SetMapIndex(key, tmp)
+	return nil
+}
+
+// afterReset returns the entries after the last !reset marker.
+// The bool is true if there was a marker.
+func afterReset(entries []*ast.Entry) ([]*ast.Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if _, ok := entries[i].Value.(*ast.Reset); ok {
+			return entries[i+1:], true
+		}
+	}
+	return entries, false
+}
+
+// labelPath appends the labels to the path, e.g. Service["prod"]
+func labelPath(path string, labels []*ast.Label) string {
+	for _, l := range labels {
+		path = fmt.Sprintf("%s[%q]", path, l.Value)
+	}
+	return path
+}
+
+// decodeLabels decodes a block and its labels into dst. Labels are used as
+// map keys first, and the remaining labels are assigned to the struct fields
+// with the label option.
+func (d *Decoder) decodeLabels(labels []*ast.Label, b *ast.Block, dst reflect.Value, path string, multi bool) error {
+	if len(labels) == 0 && !hasLabels(dst.Type()) {
+		return d.decodeValue(b, dst, path, multi)
+	}
+	if d.custom(dst.Type()) {
+		if len(labels) == 0 {
+			return d.decodeValue(b, dst, path, multi)
+		}
+		return labelError(labels[0], path, fmt.Errorf("cannot decode labels into %v", dst.Type()))
+	}
+	dst, update := realise(dst, func() reflect.Value {
+		return reflect.ValueOf(map[string]interface{}{})
+	})
+	switch dst.Kind() {
+	case reflect.Map:
+		key, err := mapKey(labels[0].Value, dst.Type().Key())
+		if err != nil {
+			return labelError(labels[0], path, err)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		// make an addressable copy of the existing value
+		tmp := reflect.New(dst.Type().Elem()).Elem()
+		if val := dst.MapIndex(key); val.IsValid() {
+			tmp.Set(val)
+		}
+		// the labels make each block unique, so it's no longer one of many
+		return d.setMapIndex(dst, key, tmp, func() error {
+			return d.decodeLabels(labels[1:], b, tmp, path, false)
+		})
 	case reflect.Slice:
 		elem := reflect.New(dst.Type().Elem()).Elem()
-		if err := decodeValue(b, elem, multi); err != nil {
+		if err := d.decodeLabels(labels, b, elem, path, multi); err != nil {
 			return err
 		}
 		update(reflect.Append(dst, elem))
 		return nil
+	case reflect.Struct:
+		ff := cachedFields(dst.Type()).labels()
+		if len(labels) != len(ff) {
+			err := fmt.Errorf("expecting %d label(s), got %d", len(ff), len(labels))
+			if len(labels) > len(ff) {
+				return labelError(labels[len(ff)], path, err)
+			}
+			return wrapError(b, dst, path, err)
+		}
+		for i, f := range ff {
+			fv := fieldByIndex(dst, f.index)
+			if fv.Kind() != reflect.String {
+				return labelError(labels[i], path, fmt.Errorf("cannot assign label to %s, expecting string", f.name))
+			}
+			fv.SetString(labels[i].Value)
+		}
+		return d.decodeValue(b, dst, path, multi)
 	default:
-		return fmt.Errorf("cannot decode block to: %v", dst.Type())
+		return labelError(labels[0], path, fmt.Errorf("cannot assign label to %v", dst.Type()))
+	}
+}
+
+// hasLabels returns true if t is a struct, or a pointer or slice of structs, with label fields
+func hasLabels(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
 	}
+	return t.Kind() == reflect.Struct && len(cachedFields(t).labels()) > 0
 }
 
-func decodeList(l *ast.List, dst reflect.Value, multi bool) error {
+func (d *Decoder) decodeList(l *ast.List, dst reflect.Value, path string, multi bool) error {
 	dst, update := realise(dst, func() reflect.Value {
 		s := []interface{}{}
 		return reflect.ValueOf(s)
 	})
 	switch dst.Kind() {
 	case reflect.Slice:
-		for _, v := range l.Values {
-			elem := reflect.New(dst.Type().Elem()).Elem()
-			if err := decodeValue(v, elem, multi); err != nil {
-				return err
+		reserve(dst, len(l.Values))
+		var errs ErrorList
+		for i, v := range l.Values {
+			s := grow(dst)
+			if err := d.decodeValue(v, s.Index(s.Len()-1), indexPath(path, i), multi); err != nil {
+				errs.Add(err)
+				continue
 			}
-			update(reflect.Append(dst, elem))
+			dst = s
 		}
-		return nil
+		update(dst)
+		return errs.Err()
+	case reflect.Array:
+		if len(l.Values) != dst.Len() {
+			return wrapError(l, dst, path, fmt.Errorf("expecting %d values, got %d", dst.Len(), len(l.Values)))
+		}
+		var errs ErrorList
+		for i, v := range l.Values {
+			errs.Add(d.decodeValue(v, dst.Index(i), indexPath(path, i), multi))
+		}
+		return errs.Err()
+	case reflect.Map:
+		if !isSet(dst.Type()) {
+			return typeError(l, dst, path)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		member := reflect.Zero(dst.Type().Elem())
+		if member.Kind() == reflect.Bool {
+			member = reflect.ValueOf(true).Convert(dst.Type().Elem())
+		}
+		var errs ErrorList
+		for i, v := range l.Values {
+			key := reflect.New(dst.Type().Key()).Elem()
+			if err := d.decodeValue(v, key, indexPath(path, i), false); err != nil {
+				errs.Add(err)
+				continue
+			}
+			dst.SetMapIndex(key, member)
+		}
+		return errs.Err()
 	default:
-		return fmt.Errorf("cannot decode block to: %v", dst.Type())
+		return typeError(l, dst, path)
 	}
 }
 
-func decodePrimitive(primitive interface{}, dst reflect.Value, multi bool) error {
+// isSet returns true if lists can be decoded into the map type.
+// The values of a set are bools or empty structs.
+func isSet(t reflect.Type) bool {
+	elem := t.Elem()
+	return elem.Kind() == reflect.Bool || (elem.Kind() == reflect.Struct && elem.NumField() == 0)
+}
+
+// mapKey converts an entry name or label into a map key of type t.
+// The key type can be a string, an integer, or implement encoding.TextUnmarshaler.
+func mapKey(name string, t reflect.Type) (reflect.Value, error) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		key := reflect.New(t)
+		if err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name)); err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot use %q as %v map key: %v", name, t, err)
+		}
+		return key.Elem(), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(name).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 0, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot use %q as %v map key", name, t)
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 0, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot use %q as %v map key", name, t)
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot use %v as a map key", t)
+	}
+}
+
+func (d *Decoder) decodePrimitive(v ast.Value, primitive interface{}, dst reflect.Value, path string) error {
 	dst, update := realise(dst, nil)
-	v := reflect.ValueOf(primitive)
-	if v.Type().ConvertibleTo(dst.Type()) {
-		v = v.Convert(dst.Type())
+	pv := reflect.ValueOf(primitive)
+	if pv.Type().ConvertibleTo(dst.Type()) {
+		pv = pv.Convert(dst.Type())
 	}
-	if !v.Type().AssignableTo(dst.Type()) {
-		return fmt.Errorf("cannot assign %v to %v", v.Type(), dst.Type())
+	if !pv.Type().AssignableTo(dst.Type()) {
+		return typeError(v, dst, path)
 	}
-	update(v)
+	update(pv)
 	return nil
 }
 
-func decodeValue(v ast.Value, dst reflect.Value, multi bool) error {
+// decodeNumber decodes a number into a numeric type.
+// Integers are parsed from the literal text so that no precision is lost,
+// and values which don't fit in dst are reported as errors.
+func (d *Decoder) decodeNumber(n *ast.Number, dst reflect.Value, path string) error {
+	dst, update := realise(dst, nil)
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := integer(n, dst.Type())
+		if err != nil {
+			return wrapError(n, dst, path, err)
+		}
+		if !i.IsInt64() || dst.OverflowInt(i.Int64()) {
+			return wrapError(n, dst, path, fmt.Errorf("%s overflows %v", describe(n), dst.Type()))
+		}
+		update(reflect.ValueOf(i.Int64()).Convert(dst.Type()))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := integer(n, dst.Type())
+		if err != nil {
+			return wrapError(n, dst, path, err)
+		}
+		if i.Sign() < 0 {
+			return wrapError(n, dst, path, fmt.Errorf("cannot assign negative %s to %v", describe(n), dst.Type()))
+		}
+		if !i.IsUint64() || dst.OverflowUint(i.Uint64()) {
+			return wrapError(n, dst, path, fmt.Errorf("%s overflows %v", describe(n), dst.Type()))
+		}
+		update(reflect.ValueOf(i.Uint64()).Convert(dst.Type()))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if dst.OverflowFloat(n.Value) {
+			return wrapError(n, dst, path, fmt.Errorf("%s overflows %v", describe(n), dst.Type()))
+		}
+		update(reflect.ValueOf(n.Value).Convert(dst.Type()))
+		return nil
+	default:
+		return d.decodePrimitive(n, n.Value, dst, path)
+	}
+}
+
+// integer returns the exact integer value of n.
+// It returns an error if n has a fractional part.
+func integer(n *ast.Number, t reflect.Type) (*big.Int, error) {
+	if n.Integer && n.Text != "" {
+		if i, ok := new(big.Int).SetString(n.Text, 0); ok {
+			return i, nil
+		}
+	}
+	if math.IsInf(n.Value, 0) || math.IsNaN(n.Value) {
+		return nil, fmt.Errorf("cannot assign %s to %v", describe(n), t)
+	}
+	i, acc := big.NewFloat(n.Value).Int(nil)
+	if acc != big.Exact {
+		return nil, fmt.Errorf("cannot assign fractional %s to %v", describe(n), t)
+	}
+	return i, nil
+}
+
+// decodeQuantity decodes sizes into numeric types. Durations are only decoded into
+// interfaces here, time.Duration values are handled by the builtin decoder.
+func (d *Decoder) decodeQuantity(q *ast.Quantity, dst reflect.Value, path string) error {
+	dst, update := realise(dst, nil)
+	switch dst.Kind() {
+	case reflect.Interface:
+		var pv reflect.Value
+		if q.Unit == ast.Duration {
+			pv = reflect.ValueOf(time.Duration(q.Value))
+		} else {
+			pv = reflect.ValueOf(q.Value)
+		}
+		if !pv.Type().AssignableTo(dst.Type()) {
+			return typeError(q, dst, path)
+		}
+		update(pv)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if q.Unit != ast.Size || dst.OverflowInt(q.Value) {
+			return typeError(q, dst, path)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if q.Unit != ast.Size || q.Value < 0 || dst.OverflowUint(uint64(q.Value)) {
+			return typeError(q, dst, path)
+		}
+	case reflect.Float32, reflect.Float64:
+		if q.Unit != ast.Size {
+			return typeError(q, dst, path)
+		}
+	default:
+		return typeError(q, dst, path)
+	}
+	update(reflect.ValueOf(q.Value).Convert(dst.Type()))
+	return nil
+}
+
+func (d *Decoder) decodeValue(v ast.Value, dst reflect.Value, path string, multi bool) error {
+	if dst.CanAddr() && d.positions != nil {
+		d.positions[dst.Addr().Interface()] = v
+	}
+	if _, ok := v.(*ast.Reset); ok {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if _, ok := v.(*ast.Null); ok && nillable(dst) {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if ok, err := d.decodeCustom(v, dst, path); ok {
+		return wrapError(v, dst, path, err)
+	}
 	switch v := v.(type) {
 	case *ast.Block:
-		return decodeBlock(v, dst, multi)
+		return d.decodeBlock(v, dst, path, multi)
 	case *ast.List:
-		return decodeList(v, dst, multi)
+		return d.decodeList(v, dst, path, multi)
 	case *ast.Number:
-		return decodePrimitive(v.Value, dst, multi)
+		return d.decodeNumber(v, dst, path)
+	case *ast.Quantity:
+		return d.decodeQuantity(v, dst, path)
 	case *ast.String:
-		return decodePrimitive(v.Value, dst, multi)
+		return d.decodePrimitive(v, v.Value, dst, path)
 	case *ast.Bool:
-		return decodePrimitive(v.Value, dst, multi)
+		return d.decodePrimitive(v, v.Value, dst, path)
+	case *ast.Null:
+		return typeError(v, dst, path)
 	default:
 		return fmt.Errorf("not implemented: %T", v)
 	}
 }
 
+// nillable returns true if null can be decoded into v
+func nillable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// decodeCustom decodes v using a registered or builtin DecodeFunc, Unmarshaler, or encoding.TextUnmarshaler.
+// RawValue destinations capture v. The first return value is false if dst doesn't have custom decoding.
+func (d *Decoder) decodeCustom(v ast.Value, dst reflect.Value, path string) (bool, error) {
+	for {
+		if dst.Type() == rawValueType {
+			dst.Set(reflect.ValueOf(d.raw(v, path)))
+			return true, nil
+		}
+		if fn, ok := d.decoder(dst.Type()); ok {
+			return true, fn(v, dst)
+		}
+		if dst.Kind() != reflect.Ptr && dst.CanAddr() {
+			switch u := dst.Addr().Interface().(type) {
+			case Unmarshaler:
+				return true, u.UnmarshalConfig(v)
+			case encoding.TextUnmarshaler:
+				if s, ok := v.(*ast.String); ok {
+					return true, u.UnmarshalText([]byte(s.Value))
+				}
+			}
+		}
+		if dst.Kind() != reflect.Ptr || !d.custom(dst.Type().Elem()) {
+			return false, nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+}
+
+// custom returns true if values of type t may have custom decoding
+func (d *Decoder) custom(t reflect.Type) bool {
+	for {
+		if t == rawValueType {
+			return true
+		}
+		if _, ok := d.decoder(t); ok {
+			return true
+		}
+		pt := reflect.PtrTo(t)
+		if pt.Implements(unmarshalerType) || pt.Implements(textUnmarshalerType) {
+			return true
+		}
+		if t.Kind() != reflect.Ptr {
+			return false
+		}
+		t = t.Elem()
+	}
+}
+
+// decoder returns the DecodeFunc for values of type t.
+// Registered decoders take precedence over the builtin ones.
+func (d *Decoder) decoder(t reflect.Type) (DecodeFunc, bool) {
+	if fn, ok := d.decoders[t]; ok {
+		return fn, true
+	}
+	fn, ok := builtin[t]
+	return fn, ok
+}
+
+// builtin contains decoders for standard library types which
+// don't implement encoding.TextUnmarshaler
+var builtin = map[reflect.Type]DecodeFunc{
+	durationType: decodeDuration,
+	bigIntType:   decodeBigInt,
+	bigFloatType: decodeBigFloat,
+}
+
+// decodeDuration decodes duration literals like 30s and strings like "1h30m".
+// Numbers without a unit are rejected, except for 0.
+func decodeDuration(v ast.Value, dst reflect.Value) error {
+	var text string
+	switch v := v.(type) {
+	case *ast.Quantity:
+		if v.Unit != ast.Duration {
+			return fmt.Errorf("cannot use %s %s as a duration", v.Unit, v.Text)
+		}
+		dst.SetInt(v.Value)
+		return nil
+	case *ast.String:
+		text = v.Value
+	case *ast.Number:
+		text = v.Text
+	default:
+		return fmt.Errorf("cannot use %s as a duration", describe(v))
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	dst.SetInt(int64(d))
+	return nil
+}
+
+// decodeBigInt decodes integers and size quantities into a big.Int
+func decodeBigInt(v ast.Value, dst reflect.Value) error {
+	i := dst.Addr().Interface().(*big.Int)
+	switch v := v.(type) {
+	case *ast.Number:
+		n, err := integer(v, dst.Type())
+		if err != nil {
+			return err
+		}
+		i.Set(n)
+		return nil
+	case *ast.Quantity:
+		if v.Unit != ast.Size {
+			return fmt.Errorf("cannot use %s %s as an integer", v.Unit, v.Text)
+		}
+		i.SetInt64(v.Value)
+		return nil
+	case *ast.String:
+		if _, ok := i.SetString(v.Value, 0); !ok {
+			return fmt.Errorf("invalid integer %q", v.Value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot use %s as an integer", describe(v))
+	}
+}
+
+// decodeBigFloat decodes numbers into a big.Float without going through float64
+func decodeBigFloat(v ast.Value, dst reflect.Value) error {
+	f := dst.Addr().Interface().(*big.Float)
+	var text string
+	switch v := v.(type) {
+	case *ast.Number:
+		if v.Text == "" {
+			f.SetFloat64(v.Value)
+			return nil
+		}
+		text = v.Text
+	case *ast.String:
+		text = v.Value
+	default:
+		return fmt.Errorf("cannot use %s as a number", describe(v))
+	}
+	if _, _, err := f.Parse(text, 0); err != nil {
+		return fmt.Errorf("invalid number %q", text)
+	}
+	return nil
+}
+
+var (
+	bigIntType          = reflect.TypeOf(big.Int{})
+	bigFloatType        = reflect.TypeOf(big.Float{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	fileModeType        = reflect.TypeOf(os.FileMode(0))
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	defaulterType       = reflect.TypeOf((*Defaulter)(nil)).Elem()
+)
+
+// grow returns s with an additional zero element. Unlike reflect.Append,
+// the element is decoded in place so that its recorded position stays valid.
+func grow(s reflect.Value) reflect.Value {
+	n := s.Len()
+	if n == s.Cap() {
+		ns := reflect.MakeSlice(s.Type(), n, 2*n+1)
+		reflect.Copy(ns, s)
+		s = ns
+	}
+	s = s.Slice(0, n+1)
+	s.Index(n).Set(reflect.Zero(s.Type().Elem()))
+	return s
+}
+
+// reserve makes sure that the slice has room for n more elements
+// so that grow doesn't move the elements decoded before them.
+func reserve(v reflect.Value, n int) {
+	if v.Kind() != reflect.Slice || !v.CanSet() || v.Cap()-v.Len() >= n {
+		return
+	}
+	s := reflect.MakeSlice(v.Type(), v.Len(), v.Len()+n)
+	reflect.Copy(s, v)
+	v.Set(s)
+}
+
 func realise(v reflect.Value, zero func() reflect.Value) (reflect.Value, func(reflect.Value)) {
 	var settable reflect.Value
 LOOP:
@@ -1,9 +1,24 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"gotest.tools/v3/assert"
+
+	"github.com/icholy/config/ast"
 )
 
 func TestUnmarshal(t *testing.T) {
@@ -33,6 +48,37 @@ func TestUnmarshal(t *testing.T) {
 		Foo []*Foo
 	}
 
+	type Common struct {
+		Name string
+	}
+
+	type Exact struct {
+		ID    int64
+		Port  uint16
+		Whole float32
+		Mode  os.FileMode
+		Hex   uint8
+		Big   float64
+	}
+
+	type Limits struct {
+		Timeout  time.Duration
+		Retry    time.Duration
+		Started  time.Time
+		MaxBody  int64
+		Buffer   uint16
+		Any      interface{}
+		Interval *time.Duration
+	}
+
+	type Tagged struct {
+		Addr     string `config:"addr"`
+		Skipped  string `config:"-"`
+		MaxConns int
+		Common   `config:",squash"`
+		Extra    *Foo `config:",inline"`
+	}
+
 	tests := []struct {
 		name  string
 		input string
@@ -190,6 +236,83 @@ func TestUnmarshal(t *testing.T) {
 				return &v
 			},
 		},
+		{
+			name:  "Comments",
+			input: "// foo\nFoo {\n  A = 123 // a\n  // b\n  B = \"hello\"\n}",
+			dst: func() interface{} {
+				return &Bar{}
+			},
+			want: func() interface{} {
+				return &Bar{
+					Foo: &Foo{A: 123, B: "hello"},
+				}
+			},
+		},
+		{
+			name:  "StructTags",
+			input: "addr = \":80\"\nMaxConns = 3\nName = \"dev\"\nA = 1",
+			dst: func() interface{} {
+				return &Tagged{}
+			},
+			want: func() interface{} {
+				return &Tagged{
+					Addr:     ":80",
+					MaxConns: 3,
+					Common:   Common{Name: "dev"},
+					Extra:    &Foo{A: 1},
+				}
+			},
+		},
+		{
+			name:  "ExactIntegers",
+			input: "ID = 9007199254740993\nPort = 65535\nWhole = 2\nMode = 0o755\nHex = 0xFF\nBig = 1_000e3",
+			dst: func() interface{} {
+				return &Exact{}
+			},
+			want: func() interface{} {
+				return &Exact{
+					ID:    9007199254740993,
+					Port:  65535,
+					Whole: 2,
+					Mode:  0755,
+					Hex:   255,
+					Big:   1e6,
+				}
+			},
+		},
+		{
+			name:  "Strings",
+			input: "B = `^\\d+$`\nA = <<-EOT\n    -----BEGIN-----\n    abc\n    EOT\nC = \"\\u00e9\\x41\\0\"",
+			dst: func() interface{} {
+				return &map[string]string{}
+			},
+			want: func() interface{} {
+				return &map[string]string{
+					"A": "-----BEGIN-----\nabc\n",
+					"B": `^\d+$`,
+					"C": "éA\x00",
+				}
+			},
+		},
+		{
+			name:  "TimeAndUnits",
+			input: "Timeout = 1m30s\nRetry = \"250ms\"\nStarted = \"2021-02-03T04:05:06Z\"\nMaxBody = 10MB\nBuffer = 4KiB\nAny = 5s\nInterval = 0",
+			dst: func() interface{} {
+				return &Limits{}
+			},
+			want: func() interface{} {
+				interval := time.Duration(0)
+				return &Limits{
+					Timeout:  90 * time.Second,
+					Retry:    250 * time.Millisecond,
+					Started:  time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+					MaxBody:  10e6,
+					Buffer:   4096,
+					Any:      5 * time.Second,
+					Interval: &interval,
+				}
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -204,8 +327,287 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestUnmarshalAliases(t *testing.T) {
+	type Config struct {
+		MaxConns int
+		HTTPAddr string
+		Port     int `config:"port_number"`
+	}
+	input := "max_conns = 1\nhttpAddr = \":80\"\nport_number = 2"
+
+	var c Config
+	err := Unmarshal([]byte(input), &c)
+	assert.Error(t, err, "1:1: no matching field: \"max_conns\"\n2:1: no matching field: \"httpAddr\"")
+
+	var d Decoder
+	d.MatchAliases(true)
+	c = Config{}
+	assert.NilError(t, d.Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c, Config{MaxConns: 1, HTTPAddr: ":80", Port: 2})
+
+	err = d.Unmarshal([]byte("port = 3"), &c)
+	assert.Error(t, err, "1:1: no matching field: \"port\"")
+}
+
+func TestUnmarshalLabels(t *testing.T) {
+	type Service struct {
+		Name string `config:",label"`
+		Addr string
+	}
+	type Listener struct {
+		Proto string `config:",label"`
+		Name  string `config:",label"`
+		Port  int
+	}
+	input := `
+		Service "dev" { Addr = ":8080" }
+		Service prod { Addr = ":80" }
+		Listener tcp "public" { Port = 443 }
+		Listener udp "dns" { Port = 53 }
+	`
+	t.Run("Struct", func(t *testing.T) {
+		var c struct {
+			Service  []*Service
+			Listener []Listener
+		}
+		assert.NilError(t, Unmarshal([]byte(input), &c))
+		assert.DeepEqual(t, c.Service, []*Service{
+			{Name: "dev", Addr: ":8080"},
+			{Name: "prod", Addr: ":80"},
+		})
+		assert.DeepEqual(t, c.Listener, []Listener{
+			{Proto: "tcp", Name: "public", Port: 443},
+			{Proto: "udp", Name: "dns", Port: 53},
+		})
+	})
+	t.Run("Map", func(t *testing.T) {
+		type Addr struct {
+			Addr string
+		}
+		type Port struct {
+			Port int
+		}
+		var c struct {
+			Service  map[string]*Addr
+			Listener map[string]map[string]Port
+		}
+		assert.NilError(t, Unmarshal([]byte(input), &c))
+		assert.DeepEqual(t, c.Service, map[string]*Addr{
+			"dev":  {Addr: ":8080"},
+			"prod": {Addr: ":80"},
+		})
+		assert.DeepEqual(t, c.Listener, map[string]map[string]Port{
+			"tcp": {"public": {Port: 443}},
+			"udp": {"dns": {Port: 53}},
+		})
+	})
+	t.Run("Interface", func(t *testing.T) {
+		var c map[string]interface{}
+		assert.NilError(t, Unmarshal([]byte(input), &c))
+		assert.DeepEqual(t, c["Listener"], map[string]interface{}{
+			"tcp": map[string]interface{}{"public": map[string]interface{}{"Port": float64(443)}},
+			"udp": map[string]interface{}{"dns": map[string]interface{}{"Port": float64(53)}},
+		})
+	})
+}
+
+type defaulted struct {
+	Name  string
+	Addr  string `default:"\":80\""`
+	Order []string
+}
+
+func (d *defaulted) SetDefaults() {
+	d.Name = "default"
+	d.Order = []string{"a", "b"}
+}
+
+func TestUnmarshalDefaults(t *testing.T) {
+	type Limits struct {
+		Timeout time.Duration `default:"30s"`
+		Sizes   []int         `default:"[1, 2KiB]"`
+	}
+	type Service struct {
+		Name     string `config:",label"`
+		Addr     string `config:",required"`
+		Insecure bool   `default:"true"`
+		Limits   Limits
+		Extra    *Limits
+		Custom   defaulted
+	}
+	var c struct {
+		Service []*Service
+	}
+	input := `
+		Service a {
+			Addr = ":80"
+			Insecure = false
+			Limits { Timeout = 5s }
+			Extra {}
+			Custom { Name = "custom" }
+		}
+		Service b {
+			Addr = ":81"
+		}
+	`
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c.Service, []*Service{
+		{
+			Name:     "a",
+			Addr:     ":80",
+			Insecure: false,
+			Limits:   Limits{Timeout: 5 * time.Second, Sizes: []int{1, 2048}},
+			Extra:    &Limits{Timeout: 30 * time.Second, Sizes: []int{1, 2048}},
+			Custom:   defaulted{Name: "custom", Addr: ":80", Order: []string{"a", "b"}},
+		},
+		{
+			Name:     "b",
+			Addr:     ":81",
+			Insecure: true,
+			Limits:   Limits{Timeout: 30 * time.Second, Sizes: []int{1, 2048}},
+			Custom:   defaulted{Name: "default", Addr: ":80", Order: []string{"a", "b"}},
+		},
+	})
+
+	// SetDefaults is called on missing nested structs like the default tags
+	var empty struct {
+		D   defaulted
+		E   struct{ F defaulted }
+		Ptr *defaulted
+	}
+	assert.NilError(t, Unmarshal([]byte(""), &empty))
+	want := defaulted{Name: "default", Addr: ":80", Order: []string{"a", "b"}}
+	assert.DeepEqual(t, empty.D, want)
+	assert.DeepEqual(t, empty.E.F, want)
+	assert.Assert(t, empty.Ptr == nil)
+}
+
+func TestUnmarshalBig(t *testing.T) {
+	var c struct {
+		Int   *big.Int
+		Size  big.Int
+		Float big.Float
+	}
+	input := "Int = 123456789012345678901234567890\nSize = 1GiB\nFloat = 0.1"
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.Equal(t, c.Int.String(), "123456789012345678901234567890")
+	assert.Equal(t, c.Size.Int64(), int64(1<<30))
+	assert.Equal(t, c.Float.Text('g', 19), "0.1")
+}
+
+func TestUnmarshalInline(t *testing.T) {
+	type Route struct {
+		Path string
+		Port int
+	}
+	type Config struct {
+		Routes  []Route
+		Ptrs    []*Route
+		Default *Route
+		Ports   map[string]int
+		Any     interface{}
+	}
+	input := strings.Join([]string{
+		`Routes = [{Path = "/a", Port = 1}, {Path = "/b", Port = 2}]`,
+		`Ptrs = [{`,
+		`  Path = "/c"`,
+		`  Port = 3`,
+		`}]`,
+		`Default = {Path = "/"}`,
+		`Ports = {http = 80, https = 443}`,
+		`Any = [{a = 1}, {b = [{c = true}]}]`,
+	}, "\n")
+	var c Config
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c, Config{
+		Routes:  []Route{{Path: "/a", Port: 1}, {Path: "/b", Port: 2}},
+		Ptrs:    []*Route{{Path: "/c", Port: 3}},
+		Default: &Route{Path: "/"},
+		Ports:   map[string]int{"http": 80, "https": 443},
+		Any: []interface{}{
+			map[string]interface{}{"a": 1.0},
+			map[string]interface{}{"b": []interface{}{map[string]interface{}{"c": true}}},
+		},
+	})
+
+	err := Unmarshal([]byte(`Routes = [{Path = "/a", Port = "x"}, {Host = "b"}]`), &c)
+	assert.Error(t, err, strings.Join([]string{
+		`1:32: cannot assign "x" to Routes[0].Port, expecting int`,
+		`1:39: Routes[1]: no matching field: "Host"`,
+	}, "\n"))
+}
+
+type CommonService struct {
+	Name    string `config:",label"`
+	Addr    string
+	Timeout time.Duration `default:"5s"`
+}
+
+type MetricsConfig struct {
+	Route string
+	Addr  string
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	type API struct {
+		CommonService
+		*MetricsConfig
+		Addr  int // hides CommonService.Addr
+		Debug bool
+	}
+	var c struct {
+		API []*API
+	}
+	input := "API \"v1\" {\n  Addr = 8080\n  Route = \"/metrics\"\n  Debug = true\n}\nAPI \"v2\" {\n  Timeout = 1s\n}"
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c.API, []*API{
+		{
+			CommonService: CommonService{Name: "v1", Timeout: 5 * time.Second},
+			MetricsConfig: &MetricsConfig{Route: "/metrics"},
+			Addr:          8080,
+			Debug:         true,
+		},
+		{
+			CommonService: CommonService{Name: "v2", Timeout: time.Second},
+		},
+	})
+
+	type Ambiguous struct {
+		CommonService
+		MetricsConfig
+	}
+	var a Ambiguous
+	err := Unmarshal([]byte("Timeout = 1s\nAddr = \":80\""), &a)
+	assert.Error(t, err, `2:1: ambiguous key "Addr" matches CommonService.Addr and MetricsConfig.Addr`)
+}
+
+func TestUnmarshalNull(t *testing.T) {
+	type Config struct {
+		Ptr   *int
+		Any   interface{}
+		List  []string
+		Map   map[string]int
+		Items []*int
+		Dur   *time.Duration
+	}
+	one := 1
+	c := Config{
+		Ptr:  &one,
+		Any:  "x",
+		List: []string{"a"},
+		Map:  map[string]int{"a": 1},
+		Dur:  new(time.Duration),
+	}
+	input := "Ptr = null\nAny = null\nList = null\nMap = null\nItems = [null, 1]\nDur = null"
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c, Config{Items: []*int{nil, &one}})
+
+	var m map[string]interface{}
+	assert.NilError(t, Unmarshal([]byte("a = null"), &m))
+	assert.DeepEqual(t, m, map[string]interface{}{"a": nil})
+}
+
 func TestError(t *testing.T) {
-	t.SkipNow()
 	tests := []struct {
 		name    string
 		input   string
@@ -221,7 +623,290 @@ func TestError(t *testing.T) {
 				}
 				return &c
 			},
-			message: "line 1: cannot assign 123 to Foo, expecting string",
+			message: "1:7: cannot assign 123 to Foo, expecting string",
+		},
+		{
+			name:  "skipped field",
+			input: "Skipped = 1",
+			dst: func() interface{} {
+				var c struct {
+					Skipped int `config:"-"`
+				}
+				return &c
+			},
+			message: "1:1: no matching field: \"Skipped\"",
+		},
+		{
+			name:  "nested path",
+			input: "Service { Addr = \":80\" }\nService {\n  Metrics {\n    Addr = 8080\n  }\n}",
+			dst: func() interface{} {
+				var c struct {
+					Service []struct {
+						Addr    string
+						Metrics struct {
+							Addr string
+						}
+					}
+				}
+				return &c
+			},
+			message: "4:12: cannot assign 8080 to Service[1].Metrics.Addr, expecting string",
+		},
+		{
+			name:  "list element",
+			input: "Items = [1, true]",
+			dst: func() interface{} {
+				var c struct {
+					Items []int
+				}
+				return &c
+			},
+			message: "1:13: cannot assign true to Items[1], expecting int",
+		},
+		{
+			name:  "block to scalar",
+			input: "Foo {}",
+			dst: func() interface{} {
+				var c struct {
+					Foo int
+				}
+				return &c
+			},
+			message: "1:5: cannot assign block to Foo, expecting int",
+		},
+		{
+			name:  "top level block",
+			input: "Foo = 1",
+			dst: func() interface{} {
+				var c int
+				return &c
+			},
+			message: "1:1: cannot assign block, expecting int",
+		},
+		{
+			name:  "int overflow",
+			input: "Port = 70000",
+			dst: func() interface{} {
+				var c struct {
+					Port uint16
+				}
+				return &c
+			},
+			message: "1:8: Port: 70000 overflows uint16",
+		},
+		{
+			name:  "int64 overflow",
+			input: "ID = 9223372036854775808",
+			dst: func() interface{} {
+				var c struct {
+					ID int64
+				}
+				return &c
+			},
+			message: "1:6: ID: 9223372036854775808 overflows int64",
+		},
+		{
+			name:  "negative to unsigned",
+			input: "Count = -1",
+			dst: func() interface{} {
+				var c struct {
+					Count uint
+				}
+				return &c
+			},
+			message: "1:9: Count: cannot assign negative -1 to uint",
+		},
+		{
+			name:  "fractional to integer",
+			input: "Count = 1.5",
+			dst: func() interface{} {
+				var c struct {
+					Count int
+				}
+				return &c
+			},
+			message: "1:9: Count: cannot assign fractional 1.5 to int",
+		},
+		{
+			name:  "inf to integer",
+			input: "Count = -inf",
+			dst: func() interface{} {
+				var c struct {
+					Count int
+				}
+				return &c
+			},
+			message: "1:9: Count: cannot assign -inf to int",
+		},
+		{
+			name:  "fractional to big.Int",
+			input: "Count = 1.5",
+			dst: func() interface{} {
+				var c struct {
+					Count *big.Int
+				}
+				return &c
+			},
+			message: "1:9: Count: cannot assign fractional 1.5 to big.Int",
+		},
+		{
+			name:  "float32 overflow",
+			input: "Ratio = 1000000000000000000000000000000000000000",
+			dst: func() interface{} {
+				var c struct {
+					Ratio float32
+				}
+				return &c
+			},
+			message: "1:9: Ratio: 1000000000000000000000000000000000000000 overflows float32",
+		},
+		{
+			name:  "missing required key",
+			input: "Service {\n  Addr = \":80\"\n}\nService {\n}",
+			dst: func() interface{} {
+				var c struct {
+					Service []struct {
+						Addr string `config:",required"`
+					}
+				}
+				return &c
+			},
+			message: "4:9: Service[1]: missing required key \"Addr\"",
+		},
+		{
+			name:  "invalid default",
+			input: "Service {}",
+			dst: func() interface{} {
+				var c struct {
+					Service struct {
+						Port int `default:"eighty"`
+					}
+				}
+				return &c
+			},
+			message: "1:9: Service.Port: invalid default \"eighty\" for int: unexpected token IDENT(\"eighty\")",
+		},
+		{
+			name:  "invalid default value",
+			input: "Service {}",
+			dst: func() interface{} {
+				var c struct {
+					Service struct {
+						Timeout time.Duration `default:"5x"`
+						Port    int           `default:"1.5"`
+					}
+				}
+				return &c
+			},
+			message: "1:9: Service.Timeout: invalid default \"5x\" for time.Duration: invalid quantity \"5x\"\n1:9: Service.Port: invalid default \"1.5\" for int: cannot assign fractional 1.5 to int",
+		},
+		{
+			name:  "duplicate labels",
+			input: "Service \"a\" {}\nService \"b\" {}\nService \"a\" {}",
+			dst: func() interface{} {
+				var c struct {
+					Service map[string]struct{}
+				}
+				return &c
+			},
+			message: "3:9: Service: duplicate block \"a\", previously declared at 1:9",
+		},
+		{
+			name:  "missing label",
+			input: "Service {}",
+			dst: func() interface{} {
+				var c struct {
+					Service struct {
+						Name string `config:",label"`
+					}
+				}
+				return &c
+			},
+			message: "1:9: Service: expecting 1 label(s), got 0",
+		},
+		{
+			name:  "extra label",
+			input: "Service a b {}",
+			dst: func() interface{} {
+				var c struct {
+					Service struct {
+						Name string `config:",label"`
+					}
+				}
+				return &c
+			},
+			message: "1:11: Service[\"a\"][\"b\"]: expecting 1 label(s), got 2",
+		},
+		{
+			name:  "duration without unit",
+			input: "Timeout = 30",
+			dst: func() interface{} {
+				var c struct {
+					Timeout time.Duration
+				}
+				return &c
+			},
+			message: "1:11: Timeout: time: missing unit in duration \"30\"",
+		},
+		{
+			name:  "size to duration",
+			input: "Timeout = 1KB",
+			dst: func() interface{} {
+				var c struct {
+					Timeout time.Duration
+				}
+				return &c
+			},
+			message: "1:11: Timeout: cannot use size 1KB as a duration",
+		},
+		{
+			name:  "duration to int",
+			input: "Size = 5s",
+			dst: func() interface{} {
+				var c struct {
+					Size int
+				}
+				return &c
+			},
+			message: "1:8: cannot assign 5s to Size, expecting int",
+		},
+		{
+			name:  "size overflow",
+			input: "Size = 1MiB",
+			dst: func() interface{} {
+				var c struct {
+					Size uint16
+				}
+				return &c
+			},
+			message: "1:8: cannot assign 1MiB to Size, expecting uint16",
+		},
+		{
+			name:  "null",
+			input: "Port = null\nTimeout = null\nName = [null]",
+			dst: func() interface{} {
+				var c struct {
+					Port    int
+					Timeout time.Duration
+					Name    []string
+				}
+				return &c
+			},
+			message: "1:8: cannot assign null to Port, expecting int\n2:11: Timeout: cannot use null as a duration\n3:9: cannot assign null to Name[0], expecting string",
+		},
+		{
+			name:  "collections",
+			input: "Version = [1, 2]\nPort \"x\" {}\nTags = [1]\nNames = [\"a\"]",
+			dst: func() interface{} {
+				var c struct {
+					Version [3]int
+					Port    map[int]struct{}
+					Tags    map[string]bool
+					Names   map[string]string
+				}
+				return &c
+			},
+			message: "1:11: Version: expecting 3 values, got 2\n2:6: Port[\"x\"]: cannot use \"x\" as int map key\n3:9: cannot assign 1 to Tags[0], expecting string\n4:9: cannot assign list to Names, expecting map[string]string",
 		},
 	}
 	for _, tt := range tests {
@@ -231,3 +916,256 @@ func TestError(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorList(t *testing.T) {
+	input := "A = \"a\"\nFoo {\n  B = 1\n  C = true\n}\nB = [1]\nD = 1"
+	var c struct {
+		A   int
+		B   string
+		Foo struct {
+			B string
+			C bool
+		}
+	}
+	err := Unmarshal([]byte(input), &c)
+	assert.Error(t, err, strings.Join([]string{
+		`1:5: cannot assign "a" to A, expecting int`,
+		`3:7: cannot assign 1 to Foo.B, expecting string`,
+		`6:5: cannot assign list to B, expecting string`,
+		`7:1: no matching field: "D"`,
+	}, "\n"))
+	assert.Equal(t, c.Foo.C, true)
+
+	var d Decoder
+	d.ErrorLimit(2)
+	err = d.Unmarshal([]byte(input), &c)
+	assert.Equal(t, len(err.(ErrorList)), 2)
+
+	err = Unmarshal([]byte("A = \nB = ]"), &c)
+	assert.Error(t, err, "1:5: unexpected token NEWLINE(\"\")\n2:5: unexpected token RBRACKET(\"]\")")
+}
+
+type Level int
+
+func (l *Level) UnmarshalConfig(v ast.Value) error {
+	s, ok := v.(*ast.String)
+	if !ok {
+		return fmt.Errorf("invalid level: %T", v)
+	}
+	switch s.Value {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return fmt.Errorf("invalid level: %q", s.Value)
+	}
+	return nil
+}
+
+func TestDecoder(t *testing.T) {
+	var c struct {
+		IP     net.IP
+		URL    *url.URL
+		Levels []Level
+		Custom Level
+	}
+	var d Decoder
+	d.RegisterDecoder(reflect.TypeOf(url.URL{}), func(v ast.Value, dst reflect.Value) error {
+		s, ok := v.(*ast.String)
+		if !ok {
+			return fmt.Errorf("expecting string, got %T", v)
+		}
+		u, err := url.Parse(s.Value)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(*u))
+		return nil
+	})
+	d.RegisterDecoder(reflect.TypeOf(Level(0)), func(v ast.Value, dst reflect.Value) error {
+		dst.SetInt(42)
+		return nil
+	})
+	input := `
+		IP = "127.0.0.1"
+		URL = "http://localhost:8080/path"
+		Custom = "anything"
+	`
+	err := d.Unmarshal([]byte(input), &c)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.IP, net.ParseIP("127.0.0.1"))
+	assert.Equal(t, c.URL.String(), "http://localhost:8080/path")
+	assert.Equal(t, c.Custom, Level(42))
+
+	err = Unmarshal([]byte(`Levels = ["debug", "info"]`), &c)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.Levels, []Level{0, 1})
+
+	err = Unmarshal([]byte(`Custom = "trace"`), &c)
+	assert.Error(t, err, `1:10: Custom: invalid level: "trace"`)
+}
+
+func TestDecodeErrorSnippet(t *testing.T) {
+	input := "Foo {\n  Bar = [1, 2]\n}"
+	var c struct {
+		Foo struct {
+			Bar string
+		}
+	}
+	err := Unmarshal([]byte(input), &c)
+	var derr *DecodeError
+	assert.Assert(t, errors.As(err, &derr), "unexpected error type: %T", err)
+	assert.Equal(t, derr.Path, "Foo.Bar")
+	assert.Equal(t, derr.Type, reflect.TypeOf(""))
+	assert.Equal(t, derr.Snippet([]byte(input)), "00002:   Bar = [1, 2]\n               ^^^^^^\n")
+}
+
+func TestDecodeFile(t *testing.T) {
+	type Metrics struct {
+		Route string
+		Addr  string
+	}
+	type Service struct {
+		Name     string
+		Addr     string
+		ID       int
+		Insecure bool
+		Deny     []string
+		Metrics  *Metrics
+	}
+	var c struct {
+		Service []*Service
+	}
+	path := filepath.Join("testdata", "services.conf")
+	err := DecodeFile(path, &c)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.Service, []*Service{
+		{Name: "dev", Addr: ":8080", Insecure: true, Deny: []string{"Reload", "Shutdown"}},
+		{Name: "prod", Addr: ":80", ID: 49283, Metrics: &Metrics{Route: "/metrics", Addr: ":8089"}},
+	})
+
+	var bad struct {
+		Service []struct {
+			Name string
+			Addr int
+		}
+	}
+	d := NewDecoder(strings.NewReader("Service {\n  Addr = \":80\"\n}"))
+	err = d.Decode(&bad)
+	assert.Error(t, err, `2:10: cannot assign ":80" to Service.Addr, expecting int`)
+
+	d.DisallowUnknownFields(false)
+	err = DecodeFile(path, &bad)
+	assert.ErrorContains(t, err, filepath.ToSlash(path)+`:3:12: cannot assign ":8080" to Service[0].Addr, expecting int`)
+}
+
+func TestDecodeIncludes(t *testing.T) {
+	type Service struct {
+		Name string
+		Port int
+	}
+	type Config struct {
+		Debug   bool
+		Service map[string]*Service
+	}
+	fsys := fstest.MapFS{
+		"main.conf":         {Data: []byte("Debug = true\ninclude \"services/*.conf\"")},
+		"services/api.conf": {Data: []byte("Service \"api\" {\n  Port = 8080\n}")},
+		"services/web.conf": {Data: []byte("Service \"web\" {\n  Port = \"80\"\n}")},
+	}
+	var c Config
+	err := DecodeFS(fsys, "main.conf", &c)
+	assert.Error(t, err, `services/web.conf:2:10: cannot assign "80" to Service["web"].Port, expecting int`)
+
+	fsys["services/web.conf"] = &fstest.MapFile{Data: []byte("Service \"web\" {\n  Port = 80\n}")}
+	c = Config{}
+	assert.NilError(t, DecodeFS(fsys, "main.conf", &c))
+	assert.DeepEqual(t, c, Config{
+		Debug: true,
+		Service: map[string]*Service{
+			"api": {Port: 8080},
+			"web": {Port: 80},
+		},
+	})
+
+	var d Decoder
+	err = d.Unmarshal([]byte("include \"main.conf\""), &c)
+	assert.Error(t, err, "1:1: include directives are not enabled")
+
+	d.IncludeFS(fsys)
+	c = Config{}
+	assert.NilError(t, d.Unmarshal([]byte("include \"services/api.conf\""), &c))
+	assert.Equal(t, c.Service["api"].Port, 8080)
+
+	var services struct {
+		Service []map[string]interface{}
+	}
+	assert.NilError(t, DecodeFile(filepath.Join("testdata", "include.conf"), &services))
+	assert.Equal(t, len(services.Service), 2)
+	assert.Equal(t, services.Service[1]["Name"], "prod")
+}
+
+func TestUnmarshalCollections(t *testing.T) {
+	type Listener struct {
+		Proto string
+	}
+	type Host struct {
+		Name string
+	}
+	type Env string
+	type Config struct {
+		Version  [3]int
+		Listener map[uint16]Listener
+		Host     map[netip.Addr]Host
+		Env      map[Env]int
+		Tags     map[string]struct{}
+		Codes    map[int]bool
+	}
+	input := strings.Join([]string{
+		`Version = [1, 2, 3]`,
+		`Listener "80" { Proto = "http" }`,
+		`Listener "0x1bb" { Proto = "https" }`,
+		`Host "10.0.0.1" { Name = "a" }`,
+		`Host "::1" { Name = "b" }`,
+		`Env = { dev = 1, prod = 2 }`,
+		`Tags = ["a", "b", "a"]`,
+		`Codes = [200, 404]`,
+	}, "\n")
+	var c Config
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c, Config{
+		Version: [3]int{1, 2, 3},
+		Listener: map[uint16]Listener{
+			80:  {Proto: "http"},
+			443: {Proto: "https"},
+		},
+		Host: map[netip.Addr]Host{
+			netip.MustParseAddr("10.0.0.1"): {Name: "a"},
+			netip.MustParseAddr("::1"):      {Name: "b"},
+		},
+		Env:   map[Env]int{"dev": 1, "prod": 2},
+		Tags:  map[string]struct{}{"a": {}, "b": {}},
+		Codes: map[int]bool{200: true, 404: true},
+	}, cmp.Comparer(func(a, b netip.Addr) bool { return a == b }))
+
+	// repeated blocks fill arrays like slices
+	var blocks struct {
+		A [2]struct{ X int }
+	}
+	assert.NilError(t, Unmarshal([]byte("A { X = 1 }\nA { X = 2 }"), &blocks))
+	assert.Equal(t, blocks.A[1].X, 2)
+	err := Unmarshal([]byte("A { X = 1 }"), &blocks)
+	assert.Error(t, err, "1:1: A: expecting 2 blocks, got 1")
+	err = Unmarshal([]byte("A { X = 1 }\nA { X = \"2\" }"), &blocks)
+	assert.Error(t, err, `2:9: cannot assign "2" to A[1].X, expecting int`)
+
+	// integer keys are labels, so they can't have scalar values
+	var scalar struct {
+		Ports map[int]string
+	}
+	err = Unmarshal([]byte(`Ports "80" { Name = "http" }`), &scalar)
+	assert.Error(t, err, `1:12: cannot assign block to Ports["80"], expecting string`)
+	err = Unmarshal([]byte(`Ports = { http = "80" }`), &scalar)
+	assert.Error(t, err, `1:11: Ports: cannot use "http" as int map key`)
+}
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Marshal returns the configuration encoding of v.
+// The value must be a struct or a map with string keys.
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalIndent(v, "", "")
+}
+
+// MarshalIndent is like Marshal but each line begins with prefix and
+// nested blocks are indented by indent.
+func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	e := &encoder{prefix: prefix, indent: indent}
+	rv := indirect(reflect.ValueOf(v))
+	if !rv.IsValid() || isText(rv) || (rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map) {
+		return nil, fmt.Errorf("cannot marshal %T, expecting struct or map", v)
+	}
+	if err := e.entries(rv, 0); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// encoder writes Go values in the configuration format
+type encoder struct {
+	buf    bytes.Buffer
+	prefix string
+	indent string
+}
+
+// line starts a new line at the given depth
+func (e *encoder) line(depth int) {
+	e.buf.WriteString(e.prefix)
+	for i := 0; i < depth; i++ {
+		e.buf.WriteString(e.indent)
+	}
+}
+
+// entries writes the fields of a struct or the keys of a map
+func (e *encoder) entries(v reflect.Value, depth int) error {
+	if v.Kind() == reflect.Map {
+		names := map[string]reflect.Value{}
+		keys := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			name, err := keyName(iter.Key())
+			if err != nil {
+				return err
+			}
+			names[name] = iter.Value()
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			if err := e.entry(name, names[name], depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, f := range cachedFields(v.Type()) {
+		if f.label {
+			// written by entry
+			continue
+		}
+		if len(f.conflicts) > 0 {
+			// ambiguous fields are omitted
+			continue
+		}
+		fv, ok := fieldByIndexNoAlloc(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		if err := e.entry(f.name, fv, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entry writes a single key and its value.
+// Nil values are omitted, decoding leaves the field untouched.
+func (e *encoder) entry(name string, v reflect.Value, depth int) error {
+	if !isIdent(name) {
+		return fmt.Errorf("cannot marshal key %q, it is not a valid identifier", name)
+	}
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	switch {
+	case isLabelMap(v):
+		return e.labelled(name, nil, v, depth)
+	case isBlock(v):
+		return e.block(name, nil, v, depth)
+	case isBlockList(v):
+		for i := 0; i < v.Len(); i++ {
+			if err := e.entry(name, v.Index(i), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		e.line(depth)
+		e.buf.WriteString(name)
+		e.buf.WriteString(" = ")
+		if err := e.value(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		e.buf.WriteString("\n")
+		return nil
+	}
+}
+
+// labels writes the values of a struct's label fields
+func (e *encoder) labels(v reflect.Value) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, f := range cachedFields(v.Type()).labels() {
+		fv, ok := fieldByIndexNoAlloc(v, f.index)
+		if !ok {
+			fv = reflect.Zero(f.typ)
+		}
+		if fv.Kind() != reflect.String {
+			return fmt.Errorf("cannot marshal %v label %q, expecting string", fv.Type(), f.name)
+		}
+		e.buf.WriteString(" ")
+		e.buf.WriteString(strconv.Quote(fv.String()))
+	}
+	return nil
+}
+
+// block writes a block with the labels followed by the label fields of v
+func (e *encoder) block(name string, labels []string, v reflect.Value, depth int) error {
+	e.line(depth)
+	e.buf.WriteString(name)
+	for _, l := range labels {
+		e.buf.WriteString(" ")
+		e.buf.WriteString(strconv.Quote(l))
+	}
+	if err := e.labels(v); err != nil {
+		return err
+	}
+	e.buf.WriteString(" {")
+	mark := e.buf.Len()
+	e.buf.WriteString("\n")
+	if err := e.entries(v, depth+1); err != nil {
+		return err
+	}
+	if e.buf.Len() == mark+1 {
+		// empty block
+		e.buf.Truncate(mark)
+	} else {
+		e.line(depth)
+	}
+	e.buf.WriteString("}\n")
+	return nil
+}
+
+// labelled writes a map with non-string keys as blocks labelled with the keys.
+// Nested maps add a label for each level. The values must be blocks.
+func (e *encoder) labelled(name string, labels []string, v reflect.Value, depth int) error {
+	keys := v.MapKeys()
+	sortKeys(keys)
+	for _, key := range keys {
+		label, err := keyName(key)
+		if err != nil {
+			return err
+		}
+		ll := append(labels[:len(labels):len(labels)], label)
+		val := indirect(v.MapIndex(key))
+		switch {
+		case !val.IsValid():
+			continue
+		case isLabelMap(val):
+			err = e.labelled(name, ll, val, depth)
+		case isBlock(val):
+			err = e.block(name, ll, val, depth)
+		default:
+			err = fmt.Errorf("%s: cannot marshal map with %v keys and %v values", name, v.Type().Key(), v.Type().Elem())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value writes a value which can appear on the right side of an assignment
+func (e *encoder) value(v reflect.Value) error {
+	v = indirect(v)
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	if v.Type() == rawValueType {
+		return fmt.Errorf("cannot marshal %v", v.Type())
+	}
+	if isText(v) {
+		text, err := marshalText(v)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteString(strconv.Quote(string(text)))
+		return nil
+	}
+	switch v.Type() {
+	case durationType:
+		e.buf.WriteString(time.Duration(v.Int()).String())
+		return nil
+	case fileModeType:
+		fmt.Fprintf(&e.buf, "0o%o", v.Uint())
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		e.buf.WriteString(strconv.Quote(v.String()))
+	case reflect.Bool:
+		e.buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("cannot marshal %v", f)
+		}
+		e.buf.WriteString(strconv.FormatFloat(f, 'f', -1, v.Type().Bits()))
+	case reflect.Slice, reflect.Array:
+		e.buf.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				e.buf.WriteString(", ")
+			}
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteString("]")
+	case reflect.Map:
+		if !isEmptySet(v.Type()) {
+			return fmt.Errorf("cannot marshal %v inside a list", v.Type())
+		}
+		return e.set(v)
+	case reflect.Struct:
+		return fmt.Errorf("cannot marshal %v inside a list", v.Type())
+	default:
+		return fmt.Errorf("cannot marshal %v", v.Type())
+	}
+	return nil
+}
+
+// set writes the keys of a map[T]struct{} as a sorted list
+func (e *encoder) set(v reflect.Value) error {
+	keys := v.MapKeys()
+	sortKeys(keys)
+	e.buf.WriteString("[")
+	for i, key := range keys {
+		if i > 0 {
+			e.buf.WriteString(", ")
+		}
+		if err := e.value(key); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteString("]")
+	return nil
+}
+
+// sortKeys sorts map keys, numbers are sorted by value
+func sortKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		default:
+			return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+		}
+	})
+}
+
+// keyName returns the entry name or label of a map key
+func keyName(key reflect.Value) (string, error) {
+	if k := indirect(key); k.IsValid() && isText(k) {
+		text, err := marshalText(k)
+		return string(text), err
+	}
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	default:
+		return "", fmt.Errorf("cannot marshal map with %v keys", key.Type())
+	}
+}
+
+// isLabelMap returns true if v is a map which is encoded as labelled blocks.
+// Keys which aren't strings can't be entry names, so they're written as labels.
+func isLabelMap(v reflect.Value) bool {
+	return v.Kind() == reflect.Map && v.Type().Key().Kind() != reflect.String && !isText(v) && !isEmptySet(v.Type())
+}
+
+// marshalText calls MarshalText on v, or a pointer to it
+func marshalText(v reflect.Value) ([]byte, error) {
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		m = v.Addr().Interface().(encoding.TextMarshaler)
+	}
+	return m.MarshalText()
+}
+
+// isEmptySet returns true if t is a map[T]struct{}, it's encoded as a list of keys
+func isEmptySet(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// isText returns true if v implements encoding.TextMarshaler
+func isText(v reflect.Value) bool {
+	if v.Type().Implements(textMarshalerType) {
+		return true
+	}
+	return v.CanAddr() && v.Addr().Type().Implements(textMarshalerType)
+}
+
+// isBlock returns true if v is encoded as a block
+func isBlock(v reflect.Value) bool {
+	return !isText(v) && v.Type() != rawValueType && (v.Kind() == reflect.Struct || (v.Kind() == reflect.Map && !isEmptySet(v.Type())))
+}
+
+// isBlockList returns true if v is a slice which is encoded as repeated blocks
+func isBlockList(v reflect.Value) bool {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	if v.Len() == 0 {
+		t := v.Type().Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if reflect.PtrTo(t).Implements(textMarshalerType) {
+			return false
+		}
+		return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+	}
+	for i := 0; i < v.Len(); i++ {
+		elem := indirect(v.Index(i))
+		if !elem.IsValid() || !isBlock(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// indirect follows pointers and interfaces. It returns the zero
+// value if it encounters a nil. The result is addressable so that
+// methods with pointer receivers can be called.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.IsValid() && !v.CanAddr() {
+		tmp := reflect.New(v.Type()).Elem()
+		tmp.Set(v)
+		v = tmp
+	}
+	return v
+}
+
+// fieldByIndexNoAlloc is like reflect.Value.FieldByIndex but returns
+// false instead of panicking when it encounters a nil pointer.
+func fieldByIndexNoAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether v is empty for the purposes of omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isIdent returns true if name can be written as an entry name
+func isIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, ch := range name {
+		isLetter := 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+		if i == 0 && !isLetter {
+			return false
+		}
+		if !isLetter && !('0' <= ch && ch <= '9') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMarshal(t *testing.T) {
+
+	type Metrics struct {
+		Route string
+		Addr  string
+	}
+
+	type Service struct {
+		Name     string
+		Addr     string `config:"addr"`
+		ID       int    `config:",omitempty"`
+		Deny     []string
+		IP       net.IP `config:",omitempty"`
+		Insecure bool   `config:",omitempty"`
+		Metrics  *Metrics
+		Secret   string `config:"-"`
+	}
+
+	type Config struct {
+		Service []*Service
+		Tags    map[string]interface{}
+	}
+
+	type Ambiguous struct {
+		CommonService
+		MetricsConfig
+		Debug bool
+	}
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		output string
+	}{
+		{
+			name:   "Primitives",
+			value:  map[string]interface{}{"b": true, "a": 1.5, "c": "hello \"world\"\n"},
+			output: "a = 1.5\nb = true\nc = \"hello \\\"world\\\"\\n\"\n",
+		},
+		{
+			name: "Struct",
+			value: &Config{
+				Service: []*Service{
+					{
+						Name: "dev",
+						Addr: ":8080",
+						Deny: []string{"Reload", "Shutdown"},
+						IP:   net.ParseIP("127.0.0.1"),
+					},
+					{
+						Name:     "prod",
+						Addr:     ":80",
+						ID:       49283,
+						Insecure: true,
+						Metrics:  &Metrics{Route: "/metrics", Addr: ":8089"},
+						Secret:   "hidden",
+					},
+				},
+				Tags: map[string]interface{}{
+					"empty": map[string]interface{}{},
+					"list":  []interface{}{1, "two", false, nil},
+				},
+			},
+			output: `Service {
+  Name = "dev"
+  addr = ":8080"
+  Deny = ["Reload", "Shutdown"]
+  IP = "127.0.0.1"
+}
+Service {
+  Name = "prod"
+  addr = ":80"
+  ID = 49283
+  Deny = []
+  Insecure = true
+  Metrics {
+    Route = "/metrics"
+    Addr = ":8089"
+  }
+}
+Tags {
+  empty {}
+  list = [1, "two", false, null]
+}
+`,
+		},
+		{
+			name: "Embedded",
+			value: Ambiguous{
+				CommonService: CommonService{Name: "api", Addr: ":80", Timeout: time.Second},
+				MetricsConfig: MetricsConfig{Route: "/metrics", Addr: ":9090"},
+				Debug:         true,
+			},
+			output: "Timeout = 1s\nRoute = \"/metrics\"\nDebug = true\n",
+		},
+		{
+			name: "Collections",
+			value: map[string]interface{}{
+				"version": [3]int{1, 2, 3},
+				"tags":    map[string]struct{}{"b": {}, "a": {}},
+				"codes":   map[int]struct{}{404: {}, 200: {}},
+				"hosts":   map[netip.Addr]struct{}{netip.MustParseAddr("10.0.0.1"): {}},
+			},
+			output: "codes = [200, 404]\nhosts = [\"10.0.0.1\"]\ntags = [\"a\", \"b\"]\nversion = [1, 2, 3]\n",
+		},
+		{
+			name: "LabelMap",
+			value: map[string]interface{}{
+				"Listener": map[uint16]Metrics{443: {Route: "/b"}, 80: {Route: "/a"}},
+				"Grid":     map[int]map[int]Metrics{1: {-2: {}}},
+			},
+			output: "Grid \"1\" \"-2\" {\n  Route = \"\"\n  Addr = \"\"\n}\nListener \"80\" {\n  Route = \"/a\"\n  Addr = \"\"\n}\nListener \"443\" {\n  Route = \"/b\"\n  Addr = \"\"\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalIndent(tt.value, "", "  ")
+			assert.NilError(t, err)
+			assert.Equal(t, string(data), tt.output)
+		})
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	type Inner struct {
+		Values []float64
+	}
+	type Labelled struct {
+		Kind string `config:",label"`
+		Name string `config:",label"`
+		Port int
+	}
+	type Outer struct {
+		Name  string `config:"name"`
+		Label []Labelled
+		Inner Inner
+		Multi []Inner
+		Map   map[string]string
+		Wait  time.Duration
+		Tick  time.Duration
+		Start time.Time
+		Mode  os.FileMode
+		*MetricsConfig
+		Version [2]int
+		Set     map[string]struct{}
+		Ports   map[uint16]Inner
+		Hosts   map[netip.Addr]*Inner
+		Grid    map[int]map[int8]Inner
+	}
+	want := Outer{
+		Wait:  90 * time.Second,
+		Tick:  500 * time.Microsecond,
+		Mode:  0644,
+		Start: time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+		Name:  "test",
+		Inner: Inner{Values: []float64{1, 2.5, -3}},
+		Label: []Labelled{{Kind: "tcp", Name: "public", Port: 443}, {Kind: "udp", Name: "dns", Port: 53}},
+		Multi: []Inner{{Values: []float64{1}}, {Values: []float64{2}}},
+		Map:   map[string]string{"a": "b", "c": "d\te", "f": "\x00é\u2028\\"},
+	}
+	want.MetricsConfig = &MetricsConfig{Route: "/metrics", Addr: ":9090"}
+	want.Version = [2]int{1, 2}
+	want.Set = map[string]struct{}{"x": {}, "y": {}}
+	want.Ports = map[uint16]Inner{80: {Values: []float64{1}}, 443: {}}
+	want.Hosts = map[netip.Addr]*Inner{netip.MustParseAddr("10.0.0.1"): {Values: []float64{2}}}
+	want.Grid = map[int]map[int8]Inner{-1: {2: {}, 10: {Values: []float64{3}}}}
+	data, err := Marshal(want)
+	assert.NilError(t, err)
+	var got Outer
+	assert.NilError(t, Unmarshal(data, &got))
+	assert.DeepEqual(t, got, want)
+}
+
+func TestMarshalError(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		message string
+	}{
+		{
+			name:    "NotBlock",
+			value:   123,
+			message: "cannot marshal int, expecting struct or map",
+		},
+		{
+			name:    "InvalidKey",
+			value:   map[string]int{"not valid": 1},
+			message: `cannot marshal key "not valid", it is not a valid identifier`,
+		},
+		{
+			name:    "BlockInList",
+			value:   map[string]interface{}{"a": []interface{}{1, map[string]int{}}},
+			message: "a: cannot marshal map[string]int inside a list",
+		},
+		{
+			name:    "LabelMapValues",
+			value:   map[string]interface{}{"a": map[int]string{1: "x"}},
+			message: "a: cannot marshal map with int keys and string values",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.value)
+			assert.Error(t, err, tt.message)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/icholy/config/ast"
+	"github.com/icholy/config/token"
+)
+
+// DecodeError is returned when an ast value cannot be decoded
+type DecodeError struct {
+	Pos   token.Pos    // start of the offending value
+	End   token.Pos    // end of the offending value
+	Path  string       // key path, e.g. Service[1].Metrics.Addr
+	Type  reflect.Type // the Go type being decoded into
+	Value ast.Value    // the value found
+	Err   error        // the underlying error, nil if the types are incompatible
+}
+
+// Error implements the error interface
+func (e *DecodeError) Error() string {
+	if e.Err == nil {
+		if e.Path == "" {
+			return fmt.Sprintf("%s: cannot assign %s, expecting %v", e.Pos, describe(e.Value), e.Type)
+		}
+		return fmt.Sprintf("%s: cannot assign %s to %s, expecting %v", e.Pos, describe(e.Value), e.Path, e.Type)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %v", e.Pos, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Pos, e.Path, e.Err)
+}
+
+// Position implements token.Positioner
+func (e *DecodeError) Position() token.Pos {
+	return e.Pos
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the lines of src containing the offending value underlined with carets.
+// The src must be the input the error was produced from.
+func (e *DecodeError) Snippet(src []byte) string {
+	return token.Highlight(string(src), e.Pos, e.End)
+}
+
+// typeError returns an error for a value which cannot be assigned to dst
+func typeError(v ast.Value, dst reflect.Value, path string) error {
+	start, end := span(v)
+	return &DecodeError{
+		Pos:   start,
+		End:   end,
+		Path:  path,
+		Type:  dst.Type(),
+		Value: v,
+	}
+}
+
+// wrapError adds position information to an error returned by custom decoding
+func wrapError(v ast.Value, dst reflect.Value, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	start, end := span(v)
+	return &DecodeError{
+		Pos:   start,
+		End:   end,
+		Path:  path,
+		Type:  dst.Type(),
+		Value: v,
+		Err:   err,
+	}
+}
+
+// keyError returns an error positioned at an entry's name
+func keyError(e *ast.Entry, path string, err error) error {
+	return &DecodeError{
+		Pos:   e.Name.Start,
+		End:   e.Name.Stop,
+		Path:  path,
+		Value: e.Value,
+		Err:   err,
+	}
+}
+
+// requiredError returns an error for a required key which is missing from the block
+func requiredError(b *ast.Block, path, name string) error {
+	return &DecodeError{
+		Pos:   b.Start,
+		End:   b.Stop,
+		Path:  path,
+		Value: b,
+		Err:   fmt.Errorf("missing required key %q", name),
+	}
+}
+
+// defaultError returns an error for a default tag which cannot be decoded into its field.
+// The err is why parsing or decoding the tag failed, its position is within the tag.
+func defaultError(b *ast.Block, path string, f field, err error) error {
+	return &DecodeError{
+		Pos:   b.Start,
+		End:   b.Stop,
+		Path:  path,
+		Value: b,
+		Err:   fmt.Errorf("invalid default %q for %v: %w", f.def, f.typ, withoutPosition(err)),
+	}
+}
+
+// withoutPosition returns err without its position and path prefix.
+// Only the first error of a list is kept.
+func withoutPosition(err error) error {
+	if list, ok := err.(token.ErrorList); ok && len(list) > 0 {
+		err = list[0]
+	}
+	if de, ok := err.(*DecodeError); ok && de.Err != nil {
+		return de.Err
+	}
+	if p, ok := err.(token.Positioner); ok {
+		return &positionless{msg: strings.TrimPrefix(err.Error(), p.Position().String()+": "), err: err}
+	}
+	return err
+}
+
+// positionless is an error with its position removed from the message
+type positionless struct {
+	msg string
+	err error
+}
+
+func (e *positionless) Error() string { return e.msg }
+func (e *positionless) Unwrap() error { return e.err }
+
+// labelError returns an error positioned at a label
+func labelError(l *ast.Label, path string, err error) error {
+	return &DecodeError{
+		Pos:  l.Start,
+		End:  l.Stop,
+		Path: path,
+		Err:  err,
+	}
+}
+
+// unionError returns an error for a value which a Union cannot select a type for
+func unionError(v ast.Value, path string, err error) error {
+	start, end := span(v)
+	return &DecodeError{
+		Pos:   start,
+		End:   end,
+		Path:  path,
+		Value: v,
+		Err:   err,
+	}
+}
+
+// duplicateError returns an error for a block which has the same labels as prev
+func duplicateError(e, prev *ast.Entry, path string) error {
+	labels := make([]string, len(e.Labels))
+	for i, l := range e.Labels {
+		labels[i] = l.Text
+	}
+	return &DecodeError{
+		Pos:   e.Labels[0].Start,
+		End:   e.Labels[len(e.Labels)-1].Stop,
+		Path:  path,
+		Value: e.Value,
+		Err:   fmt.Errorf("duplicate block %s, previously declared at %s", strings.Join(labels, " "), prev.Labels[0].Start),
+	}
+}
+
+// span returns the start and end positions of v
+func span(v ast.Value) (token.Pos, token.Pos) {
+	if v == nil {
+		return token.Pos{}, token.Pos{}
+	}
+	return v.Pos(), v.End()
+}
+
+// describe returns a short description of v for error messages
+func describe(v ast.Value) string {
+	switch v := v.(type) {
+	case *ast.Block:
+		return "block"
+	case *ast.List:
+		return "list"
+	case *ast.Number:
+		if v.Text != "" {
+			return v.Text
+		}
+		return strconv.FormatFloat(v.Value, 'f', -1, 64)
+	case *ast.Quantity:
+		return v.Text
+	case *ast.String:
+		return strconv.Quote(v.Value)
+	case *ast.Bool:
+		return strconv.FormatBool(v.Value)
+	case *ast.Null:
+		return "null"
+	case *ast.Reset:
+		return "!reset"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
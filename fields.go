@@ -0,0 +1,303 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/icholy/config/ast"
+)
+
+// field is a struct field which entries can be decoded into
+type field struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	aliases   []string
+	goPath    string // the path of Go field names, e.g. Common.Addr
+	tagged    bool   // the name is from the tag
+	omitEmpty bool
+	label     bool // the field is set from a block label
+	required  bool
+	validate  string // the validate tag
+	// def is the value of the default tag, it's parsed into defValue
+	def        string
+	hasDefault bool
+	defValue   ast.Value
+	defErr     error // the error parsing def, it's reported when the default is used
+	// conflicts are the Go field paths of the promoted fields which
+	// have the same name at the same depth. The field can't be used.
+	conflicts []string
+}
+
+// fields is the list of decodable fields in a struct type
+type fields []field
+
+// byName returns the field matching the entry name. If aliases is true,
+// the snake_case and lowerCamel forms of untagged field names match too.
+// Exact matches take precedence over aliases. Label fields never match.
+func (ff fields) byName(name string, aliases bool) (field, bool) {
+	for _, f := range ff {
+		if f.name == name && !f.label {
+			return f, true
+		}
+	}
+	if !aliases {
+		return field{}, false
+	}
+	for _, f := range ff {
+		if f.label {
+			continue
+		}
+		for _, alias := range f.aliases {
+			if alias == name {
+				return f, true
+			}
+		}
+	}
+	return field{}, false
+}
+
+// labels returns the fields which are set from block labels
+func (ff fields) labels() fields {
+	var labels fields
+	for _, f := range ff {
+		if f.label {
+			labels = append(labels, f)
+		}
+	}
+	return labels
+}
+
+// hasDefaults returns true if struct type t, or any of its struct fields,
+// have a default tag or implement Defaulter
+func hasDefaults(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(defaulterType) {
+		return true
+	}
+	for _, f := range cachedFields(t) {
+		if f.hasDefault {
+			return true
+		}
+		if f.typ.Kind() == reflect.Struct && hasDefaults(f.typ) {
+			return true
+		}
+	}
+	return false
+}
+
+var fieldCache sync.Map // map[reflect.Type]fields
+
+// cachedFields is like typeFields but caches the result
+func cachedFields(t reflect.Type) fields {
+	if ff, ok := fieldCache.Load(t); ok {
+		return ff.(fields)
+	}
+	ff, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return ff.(fields)
+}
+
+// typeFields returns the fields of struct type t. The fields of embedded
+// structs, and fields with the squash option, are promoted following Go's
+// rules: shallower fields hide deeper fields with the same name, and at the
+// same depth a field named by its tag hides the others. Names which are still
+// ambiguous are returned as a single field with the conflicting fields set.
+func typeFields(t reflect.Type) fields {
+	all := collectFields(t, nil, "", map[reflect.Type]bool{t: true})
+	groups := map[string][]int{}
+	for i, f := range all {
+		groups[f.name] = append(groups[f.name], i)
+	}
+	var ff fields
+	for i, f := range all {
+		candidates := dominant(all, groups[f.name])
+		if candidates[0] != i {
+			continue
+		}
+		if len(candidates) > 1 {
+			for _, j := range candidates {
+				f.conflicts = append(f.conflicts, all[j].goPath)
+			}
+		}
+		ff = append(ff, f)
+	}
+	return ff
+}
+
+// dominant returns the indexes of the fields in the group which aren't
+// hidden by another field. There's more than one if the name is ambiguous.
+func dominant(all fields, group []int) []int {
+	depth := len(all[group[0]].index)
+	for _, i := range group {
+		if d := len(all[i].index); d < depth {
+			depth = d
+		}
+	}
+	var shallow, tagged []int
+	for _, i := range group {
+		if len(all[i].index) == depth {
+			shallow = append(shallow, i)
+			if all[i].tagged {
+				tagged = append(tagged, i)
+			}
+		}
+	}
+	if len(tagged) > 0 && len(shallow) > 1 {
+		return tagged
+	}
+	return shallow
+}
+
+// collectFields returns the fields of struct type t and the fields of the
+// structs it embeds. The index and Go field path of the embedded fields are
+// prefixed with index and prefix. The visited types are used to prevent cycles.
+func collectFields(t reflect.Type, index []int, prefix string, visited map[reflect.Type]bool) fields {
+	var ff fields
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("config")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		promote := opts.Contains("squash") || opts.Contains("inline") || (sf.Anonymous && name == "")
+		if promote && ft.Kind() == reflect.Struct {
+			// pointers to unexported structs can't be allocated
+			if sf.PkgPath != "" && sf.Type.Kind() == reflect.Ptr {
+				continue
+			}
+			if !visited[ft] {
+				visited[ft] = true
+				ff = append(ff, collectFields(ft, idx, prefix+sf.Name+".", visited)...)
+				delete(visited, ft)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := field{
+			name:      name,
+			index:     idx,
+			typ:       sf.Type,
+			goPath:    prefix + sf.Name,
+			tagged:    name != "",
+			omitEmpty: opts.Contains("omitempty"),
+			label:     opts.Contains("label"),
+			required:  opts.Contains("required"),
+			validate:  sf.Tag.Get("validate"),
+		}
+		f.def, f.hasDefault = sf.Tag.Lookup("default")
+		if f.hasDefault {
+			f.defValue, f.defErr = ast.ParseValue(f.def)
+		}
+		if f.name == "" {
+			f.name = sf.Name
+			f.aliases = aliases(sf.Name)
+		}
+		ff = append(ff, f)
+	}
+	return ff
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but it allocates
+// nil pointers to squashed structs.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// tagOptions is the comma separated list of options following
+// the name in a struct tag.
+type tagOptions string
+
+// parseTag splits a struct tag into its name and options
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+	return tag, ""
+}
+
+// Contains reports whether the options contain name
+func (o tagOptions) Contains(name string) bool {
+	for _, opt := range strings.Split(string(o), ",") {
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+// aliases returns the snake_case and lowerCamel forms of a field name
+func aliases(name string) []string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return nil
+	}
+	lower := make([]string, len(words))
+	for i, w := range words {
+		lower[i] = strings.ToLower(w)
+	}
+	camel := lower[0]
+	for _, w := range lower[1:] {
+		camel += strings.ToUpper(w[:1]) + w[1:]
+	}
+	var aa []string
+	for _, alias := range []string{strings.Join(lower, "_"), camel} {
+		if alias != name && (len(aa) == 0 || aa[0] != alias) {
+			aa = append(aa, alias)
+		}
+	}
+	return aa
+}
+
+// splitWords splits a Go identifier into words.
+// Acronyms are kept together: HTTPAddr becomes HTTP, Addr.
+func splitWords(name string) []string {
+	var words []string
+	rr := []rune(name)
+	start := 0
+	for i := 1; i < len(rr); i++ {
+		switch {
+		case rr[i] == '_':
+			words = append(words, string(rr[start:i]))
+			start = i + 1
+		case unicode.IsUpper(rr[i]) && !unicode.IsUpper(rr[i-1]) && rr[i-1] != '_':
+			words = append(words, string(rr[start:i]))
+			start = i
+		case unicode.IsUpper(rr[i]) && i+1 < len(rr) && unicode.IsLower(rr[i+1]) && unicode.IsUpper(rr[i-1]):
+			words = append(words, string(rr[start:i]))
+			start = i
+		}
+	}
+	if start < len(rr) {
+		words = append(words, string(rr[start:]))
+	}
+	var nonempty []string
+	for _, w := range words {
+		if w != "" {
+			nonempty = append(nonempty, w)
+		}
+	}
+	return nonempty
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases []string
+	}{
+		{"Name", []string{"name"}},
+		{"MaxConns", []string{"max_conns", "maxConns"}},
+		{"HTTPAddr", []string{"http_addr", "httpAddr"}},
+		{"ID", []string{"id"}},
+		{"Read_Timeout", []string{"read_timeout", "readTimeout"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, aliases(tt.name), tt.aliases)
+		})
+	}
+}
+
+type embeddedBase struct {
+	Name string
+	Addr string
+	Port int
+}
+
+type EmbeddedExtra struct {
+	Name  string
+	Debug bool
+	Port  int `config:"Port"`
+}
+
+type embeddedLoop struct {
+	*embeddedLoop
+	Value int
+}
+
+func TestTypeFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		names []string
+	}{
+		{
+			name: "Promoted",
+			value: struct {
+				embeddedBase
+				Debug bool
+			}{},
+			names: []string{"Name", "Addr", "Port", "Debug"},
+		},
+		{
+			name: "Shadowed",
+			value: struct {
+				Addr int
+				embeddedBase
+				*embeddedLoop // pointers to unexported structs can't be allocated
+			}{},
+			names: []string{"Addr", "Name", "Port"},
+		},
+		{
+			name: "Conflict",
+			value: struct {
+				embeddedBase
+				*EmbeddedExtra
+			}{},
+			names: []string{"Name!embeddedBase.Name,EmbeddedExtra.Name", "Addr", "Debug", "Port"},
+		},
+		{
+			name: "Named",
+			value: struct {
+				EmbeddedExtra `config:"Extra"`
+				embeddedBase  `config:",squash"`
+			}{},
+			names: []string{"Extra", "Name", "Addr", "Port"},
+		},
+		{
+			name:  "Cycle",
+			value: embeddedLoop{},
+			names: []string{"Value"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, f := range typeFields(reflect.TypeOf(tt.value)) {
+				name := f.name
+				if len(f.conflicts) > 0 {
+					name += "!" + strings.Join(f.conflicts, ",")
+				}
+				names = append(names, name)
+			}
+			assert.DeepEqual(t, names, tt.names)
+		})
+	}
+}
@@ -1,8 +1,13 @@
 module github.com/icholy/config
 
-go 1.15
+go 1.20
 
 require (
 	github.com/google/go-cmp v0.4.0
 	gotest.tools/v3 v3.0.3
 )
+
+require (
+	github.com/pkg/errors v0.8.1 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+)
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/icholy/config/ast"
+)
+
+// LookupFunc returns the value of a variable and whether it is set.
+// os.LookupEnv is a LookupFunc.
+type LookupFunc func(name string) (string, bool)
+
+// Interpolate enables the substitution of variables in quoted and heredoc
+// strings before they are decoded. Raw strings are left as is. The supported
+// forms are:
+//
+//	${VAR}           the value of VAR, it's an error if VAR is not set
+//	${VAR:-default}  the default if VAR is not set or empty
+//	${VAR:?message}  an error with the message if VAR is not set or empty
+//	$${              a literal ${
+//
+// The default and the message can contain references, like ${VAR:-${OTHER}},
+// which are only substituted when they're used. A nil lookup disables interpolation.
+func (d *Decoder) Interpolate(lookup LookupFunc) {
+	d.lookup = lookup
+}
+
+// interpolateBlock substitutes the variables in all the strings of the block
+func interpolateBlock(b *ast.Block, lookup LookupFunc) error {
+	var errs ErrorList
+	for _, e := range b.Entries {
+		errs.Add(interpolateValue(e.Value, lookup))
+	}
+	return errs.Err()
+}
+
+// interpolateValue substitutes the variables in the strings of v
+func interpolateValue(v ast.Value, lookup LookupFunc) error {
+	switch v := v.(type) {
+	case *ast.Block:
+		return interpolateBlock(v, lookup)
+	case *ast.List:
+		var errs ErrorList
+		for _, v := range v.Values {
+			errs.Add(interpolateValue(v, lookup))
+		}
+		return errs.Err()
+	case *ast.String:
+		if v.Kind == ast.Raw {
+			return nil
+		}
+		s, err := interpolate(v.Value, lookup)
+		if err != nil {
+			return &DecodeError{Pos: v.Start, End: v.Stop, Value: v, Err: err}
+		}
+		v.Value = s
+		return nil
+	default:
+		return nil
+	}
+}
+
+// interpolate substitutes the variable references in s
+func interpolate(s string, lookup LookupFunc) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i == -1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		switch {
+		case strings.HasPrefix(s, "$${"):
+			b.WriteString("${")
+			s = s[3:]
+		case strings.HasPrefix(s, "${"):
+			end := closingBrace(s)
+			if end == -1 {
+				return "", fmt.Errorf("unterminated variable reference: %s", s)
+			}
+			value, err := expand(s[2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			s = s[end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[1:]
+		}
+	}
+}
+
+// closingBrace returns the index of the } which ends the reference at the
+// start of s, skipping nested references. It returns -1 if there isn't one.
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// expand returns the value of a variable reference without the ${ and }
+func expand(ref string, lookup LookupFunc) (string, error) {
+	name, op, arg := ref, "", ""
+	if i := strings.IndexByte(ref, ':'); i != -1 {
+		name, op = ref[:i], ref[i:]
+		if len(op) > 2 {
+			op, arg = op[:2], op[2:]
+		}
+	}
+	if !isVariable(name) {
+		return "", fmt.Errorf("invalid variable reference: ${%s}", ref)
+	}
+	value, ok := lookup(name)
+	switch op {
+	case "":
+		if !ok {
+			return "", fmt.Errorf("variable %s is not set", name)
+		}
+	case ":-":
+		if value == "" {
+			return interpolate(arg, lookup)
+		}
+	case ":?":
+		if value == "" {
+			if arg == "" {
+				return "", fmt.Errorf("variable %s is not set", name)
+			}
+			message, err := interpolate(arg, lookup)
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("%s: %s", name, message)
+		}
+	default:
+		return "", fmt.Errorf("invalid variable reference: ${%s}", ref)
+	}
+	return value, nil
+}
+
+// isVariable returns true if name is a valid variable name
+func isVariable(name string) bool {
+	for i, ch := range name {
+		isLetter := 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+		if !isLetter && (i == 0 || !('0' <= ch && ch <= '9')) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{
+		"HOST":  "example.com",
+		"PORT":  "8080",
+		"EMPTY": "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	tests := []struct {
+		input   string
+		output  string
+		message string
+	}{
+		{input: "plain", output: "plain"},
+		{input: "${HOST}:${PORT}", output: "example.com:8080"},
+		{input: "${EMPTY}", output: ""},
+		{input: "${ADDR:-:80}", output: ":80"},
+		{input: "${EMPTY:-default}", output: "default"},
+		{input: "${HOST:-default}", output: "example.com"},
+		{input: "${HOST:?required}", output: "example.com"},
+		{input: "$${HOST} costs $5", output: "${HOST} costs $5"},
+		{input: "${ADDR:-${HOST}:${PORT}}", output: "example.com:8080"},
+		{input: "${ADDR:-${EMPTY:-${PORT}}}x", output: "8080x"},
+		{input: "${HOST:-${MISSING}}", output: "example.com"},
+		{input: "${ADDR:-$${HOST}}", output: "${HOST}"},
+		{input: "${ADDR:-${MISSING}}", message: "variable MISSING is not set"},
+		{input: "${EMPTY:?set ${HOST}}", message: "EMPTY: set example.com"},
+		{input: "${ADDR:-${HOST}", message: "unterminated variable reference: ${ADDR:-${HOST}"},
+		{input: "${MISSING}", message: "variable MISSING is not set"},
+		{input: "${EMPTY:?must be set}", message: "EMPTY: must be set"},
+		{input: "${MISSING:?}", message: "variable MISSING is not set"},
+		{input: "${HOST", message: "unterminated variable reference: ${HOST"},
+		{input: "${1HOST}", message: "invalid variable reference: ${1HOST}"},
+		{input: "${HOST:=x}", message: "invalid variable reference: ${HOST:=x}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			output, err := interpolate(tt.input, lookup)
+			if tt.message != "" {
+				assert.Error(t, err, tt.message)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, output, tt.output)
+		})
+	}
+}
+
+func TestDecoderInterpolate(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "PORT" {
+			return "9090", true
+		}
+		return "", false
+	}
+	var c struct {
+		Addr  string
+		Hosts []string
+		Raw   string
+		Query string
+	}
+	input := "Addr = \":${PORT}\"\nHosts = [\"${HOST:-localhost}\"]\nRaw = `${PORT}`\nQuery = <<EOT\nport ${PORT}\nEOT"
+	var d Decoder
+	d.Interpolate(lookup)
+	assert.NilError(t, d.Unmarshal([]byte(input), &c))
+	assert.Equal(t, c.Addr, ":9090")
+	assert.DeepEqual(t, c.Hosts, []string{"localhost"})
+	assert.Equal(t, c.Raw, "${PORT}")
+	assert.Equal(t, c.Query, "port 9090\n")
+
+	err := d.Unmarshal([]byte("Addr = \"${HOST}\"\nBlock {\n  Addr = \"${TOKEN:?is required}\"\n}"), &c)
+	assert.Error(t, err, "1:8: variable HOST is not set\n3:10: TOKEN: is required")
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/icholy/config/ast"
+)
+
+// MergeStrategy controls how entries are combined with the entries
+// of the same name in earlier blocks
+type MergeStrategy int
+
+const (
+	// MergeDeep merges blocks with the same name and labels recursively.
+	// Other values replace the earlier values.
+	MergeDeep MergeStrategy = iota
+	// MergeReplace replaces the earlier entries
+	MergeReplace
+	// MergeAppend keeps the earlier entries. Lists are concatenated
+	// and blocks are added alongside the earlier blocks.
+	MergeAppend
+)
+
+// String returns the name of the strategy
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeDeep:
+		return "deep"
+	case MergeReplace:
+		return "replace"
+	case MergeAppend:
+		return "append"
+	default:
+		return "unknown"
+	}
+}
+
+// Merger merges blocks. The zero value deep merges every key.
+type Merger struct {
+	// Strategy is used for the keys which aren't in Keys
+	Strategy MergeStrategy
+	// Keys maps key paths, like Server.Allow, to the strategy used for them.
+	// The paths only contain entry names, labels are not included.
+	Keys map[string]MergeStrategy
+}
+
+// Merge merges the blocks using the zero Merger
+func Merge(blocks ...*ast.Block) *ast.Block {
+	var m Merger
+	return m.Merge(blocks...)
+}
+
+// Merge returns a block containing the entries of the blocks.
+// Later blocks take precedence over earlier ones. Assigning !reset
+// to a key discards its entries from the earlier blocks.
+// The blocks are not modified and the result shares their nodes.
+func (m *Merger) Merge(blocks ...*ast.Block) *ast.Block {
+	merged := &ast.Block{}
+	for _, b := range blocks {
+		m.merge(merged, b, "")
+	}
+	return merged
+}
+
+// merge adds the entries of src to dst. Only dst's entry slice is modified,
+// entries which need to be changed are copied. Entries are only merged with
+// the ones from earlier sources, repeated entries within src are kept. Repeated
+// blocks are merged in order, the nth block from src is merged with the nth
+// earlier block with the same name and labels.
+func (m *Merger) merge(dst, src *ast.Block, path string) {
+	// names which have been replaced by an entry in src
+	replaced := map[string]bool{}
+	// entries which were added from src, or which a block from src was merged into
+	skip := map[*ast.Entry]bool{}
+	for _, e := range src.Entries {
+		name := e.Name.Value
+		p := joinPath(path, name)
+		if _, ok := e.Value.(*ast.Reset); ok {
+			dst.Entries = removeEntries(dst.Entries, name)
+			dst.Entries = append(dst.Entries, e)
+			replaced[name] = true
+			continue
+		}
+		switch m.strategy(p) {
+		case MergeAppend:
+			if i := lastEntry(dst.Entries, e, skip); i != -1 {
+				if l, ok := e.Value.(*ast.List); ok {
+					if prev, ok := dst.Entries[i].Value.(*ast.List); ok {
+						dst.Entries[i] = concat(dst.Entries[i], prev, l)
+						continue
+					}
+				}
+			}
+		case MergeDeep:
+			if b, ok := e.Value.(*ast.Block); ok {
+				if i := firstEntry(dst.Entries, e, skip); i != -1 {
+					if prev, ok := dst.Entries[i].Value.(*ast.Block); ok {
+						cp := *dst.Entries[i]
+						child := &ast.Block{
+							Start:   prev.Start,
+							Stop:    prev.Stop,
+							Entries: append([]*ast.Entry(nil), prev.Entries...),
+							Footer:  prev.Footer,
+							Inline:  prev.Inline,
+						}
+						m.merge(child, b, p)
+						cp.Value = child
+						dst.Entries[i] = &cp
+						skip[&cp] = true
+						continue
+					}
+				}
+				break
+			}
+			fallthrough
+		case MergeReplace:
+			if !replaced[name] {
+				dst.Entries = removeEntries(dst.Entries, name)
+				replaced[name] = true
+			}
+		}
+		dst.Entries = append(dst.Entries, e)
+		skip[e] = true
+	}
+}
+
+// strategy returns the strategy for the key path
+func (m *Merger) strategy(path string) MergeStrategy {
+	if s, ok := m.Keys[path]; ok {
+		return s
+	}
+	return m.Strategy
+}
+
+// removeEntries returns the entries without the ones with the name
+func removeEntries(entries []*ast.Entry, name string) []*ast.Entry {
+	kept := entries[:0:0]
+	for _, e := range entries {
+		if e.Name.Value != name {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// lastEntry returns the index of the last entry with the same name and labels as e,
+// or -1. The skipped entries aren't considered.
+func lastEntry(entries []*ast.Entry, e *ast.Entry, skip map[*ast.Entry]bool) int {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !skip[entries[i]] && sameEntry(entries[i], e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstEntry is like lastEntry but returns the index of the first entry
+func firstEntry(entries []*ast.Entry, e *ast.Entry, skip map[*ast.Entry]bool) int {
+	for i, x := range entries {
+		if !skip[x] && sameEntry(x, e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameEntry returns true if the entries have the same name and labels
+func sameEntry(a, b *ast.Entry) bool {
+	return a.Name.Value == b.Name.Value && reflect.DeepEqual(labelValues(a), labelValues(b))
+}
+
+// labelValues returns the values of the entry's labels
+func labelValues(e *ast.Entry) []string {
+	values := make([]string, len(e.Labels))
+	for i, l := range e.Labels {
+		values[i] = l.Value
+	}
+	return values
+}
+
+// concat returns a copy of the entry with the values of both lists
+func concat(e *ast.Entry, a, b *ast.List) *ast.Entry {
+	cp := *e
+	cp.Value = &ast.List{
+		Start:    a.Start,
+		Stop:     a.Stop,
+		Values:   append(append([]ast.Value(nil), a.Values...), b.Values...),
+		Leading:  a.Leading,
+		Trailing: a.Trailing,
+		Footer:   a.Footer,
+	}
+	return &cp
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/icholy/config/ast"
+	"github.com/icholy/config/ast/printer"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []string
+		merger Merger
+		output string
+	}{
+		{
+			name: "Deep",
+			layers: []string{
+				"Debug = false\nAllow = [\"a\"]\nServer {\n  Addr = \":80\"\n  Tags = [\"x\"]\n}\nService \"api\" {\n  Port = 1\n}",
+				"Debug = true\nAllow = [\"b\"]\nServer {\n  Addr = \":8080\"\n}\nService \"web\" {\n  Port = 2\n}",
+			},
+			output: "Server {\n    Tags = [\"x\"]\n    Addr = \":8080\"\n}\nService \"api\" {\n    Port = 1\n}\nDebug = true\nAllow = [\"b\"]\n\nService \"web\" {\n    Port = 2\n}\n",
+		},
+		{
+			name: "Replace",
+			layers: []string{
+				"Server {\n  Addr = \":80\"\n  Tags = [\"x\"]\n}\nPort = 1",
+				"Server {\n  Addr = \":8080\"\n}\nServer {\n  Addr = \":9090\"\n}",
+			},
+			merger: Merger{Strategy: MergeReplace},
+			output: "Port = 1\nServer {\n    Addr = \":8080\"\n}\nServer {\n    Addr = \":9090\"\n}\n",
+		},
+		{
+			name: "Append",
+			layers: []string{
+				"Allow = [\"a\"]\nDeny = [\"x\"]\nServer {\n  Tags = [\"x\"]\n}",
+				"Allow = [\"b\", \"c\"]\nDeny = [\"y\"]\nServer {\n  Tags = [\"y\"]\n}",
+			},
+			merger: Merger{
+				Keys: map[string]MergeStrategy{
+					"Allow":       MergeAppend,
+					"Server.Tags": MergeAppend,
+				},
+			},
+			output: "Allow = [\"a\", \"b\", \"c\"]\n\nServer {\n    Tags = [\"x\", \"y\"]\n}\nDeny = [\"y\"]\n",
+		},
+		{
+			name: "AppendBlocks",
+			layers: []string{
+				"Service {\n  Name = \"a\"\n}",
+				"Service {\n  Name = \"b\"\n}",
+			},
+			merger: Merger{Strategy: MergeAppend},
+			output: "Service {\n    Name = \"a\"\n}\nService {\n    Name = \"b\"\n}\n",
+		},
+		{
+			name: "RepeatedBlocks",
+			layers: []string{
+				"Service {\n  Name = \"a\"\n}\nService {\n  Name = \"b\"\n}",
+				"Service {\n  Port = 1\n}",
+			},
+			output: "Service {\n    Name = \"a\"\n    Port = 1\n}\nService {\n    Name = \"b\"\n}\n",
+		},
+		{
+			name: "Reset",
+			layers: []string{
+				"Allow = [\"a\"]\nService \"api\" {\n  Port = 1\n}\nService \"web\" {\n  Port = 2\n}",
+				"Allow = !reset\nService = !reset\nService \"db\" {\n  Port = 3\n}",
+				"Allow = [\"b\"]",
+			},
+			merger: Merger{Strategy: MergeAppend},
+			output: "Allow   = !reset\nService = !reset\nService \"db\" {\n    Port = 3\n}\nAllow = [\"b\"]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var blocks []*ast.Block
+			for _, layer := range tt.layers {
+				b, err := ast.Parse(layer)
+				assert.NilError(t, err)
+				blocks = append(blocks, b)
+			}
+			before := format(t, blocks[0])
+			merged := tt.merger.Merge(blocks...)
+			assert.Equal(t, format(t, merged), tt.output)
+			assert.Equal(t, format(t, blocks[0]), before, "input was modified")
+		})
+	}
+}
+
+func format(t *testing.T, b *ast.Block) string {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NilError(t, printer.Fprint(&buf, b))
+	return buf.String()
+}
+
+func TestDecodeFiles(t *testing.T) {
+	type Service struct {
+		Port  int
+		Allow []string
+	}
+	type Config struct {
+		Debug   bool
+		Allow   []string
+		Service map[string]*Service
+	}
+	fsys := fstest.MapFS{
+		"base.conf":  {Data: []byte("Allow = [\"a\"]\nService \"api\" {\n  Port = 1\n  Allow = [\"x\"]\n}\nService \"web\" {\n  Port = 2\n}")},
+		"prod.conf":  {Data: []byte("Allow = [\"b\"]\nService \"api\" {\n  Allow = [\"y\"]\n}")},
+		"local.conf": {Data: []byte("Debug = true\nService \"web\" {\n  Port = \"x\"\n}")},
+		"reset.conf": {Data: []byte("Service = !reset")},
+	}
+	var d Decoder
+	d.IncludeFS(fsys)
+	d.MergeStrategy("Service.Allow", MergeAppend)
+	var c Config
+	err := d.DecodeFiles([]string{"base.conf", "prod.conf", "local.conf"}, &c)
+	assert.Error(t, err, `local.conf:3:10: cannot assign "x" to Service["web"].Port, expecting int`)
+
+	c = Config{}
+	assert.NilError(t, d.DecodeFiles([]string{"base.conf", "prod.conf"}, &c))
+	assert.DeepEqual(t, c, Config{
+		Allow: []string{"b"},
+		Service: map[string]*Service{
+			"api": {Port: 1, Allow: []string{"x", "y"}},
+			"web": {Port: 2},
+		},
+	})
+
+	c = Config{}
+	assert.NilError(t, d.DecodeFiles([]string{"base.conf", "reset.conf"}, &c))
+	assert.DeepEqual(t, c, Config{Allow: []string{"a"}})
+
+	err = d.DecodeFiles([]string{"base.conf", "missing.conf"}, &c)
+	assert.ErrorContains(t, err, "open missing.conf")
+}
+
+func TestDecodeFilesRepeated(t *testing.T) {
+	type Service struct {
+		Name string
+	}
+	type Config struct {
+		Service []*Service
+	}
+	fsys := fstest.MapFS{
+		"a.conf": {Data: []byte("Service {\n  Name = \"a\"\n}\nService {\n  Name = \"b\"\n}")},
+		"b.conf": {Data: []byte("Service {\n  Name = \"c\"\n}\nService {\n  Name = \"d\"\n}")},
+		"c.conf": {Data: []byte("Service {\n  Name = \"e\"\n}\nService {\n  Name = \"d\"\n}\nService {\n  Name = \"f\"\n}")},
+	}
+	var want Config
+	assert.NilError(t, DecodeFS(fsys, "a.conf", &want))
+	assert.DeepEqual(t, want, Config{Service: []*Service{{Name: "a"}, {Name: "b"}}})
+
+	var d Decoder
+	d.IncludeFS(fsys)
+	var c Config
+	assert.NilError(t, d.DecodeFiles([]string{"a.conf"}, &c))
+	assert.DeepEqual(t, c, want)
+
+	c = Config{}
+	assert.NilError(t, d.DecodeFiles([]string{"a.conf", "b.conf"}, &c))
+	assert.DeepEqual(t, c, Config{Service: []*Service{{Name: "c"}, {Name: "d"}}})
+
+	c = Config{}
+	assert.NilError(t, d.DecodeFiles([]string{"b.conf", "c.conf"}, &c))
+	assert.DeepEqual(t, c, Config{Service: []*Service{{Name: "e"}, {Name: "d"}, {Name: "f"}}})
+}
+
+func TestUnmarshalReset(t *testing.T) {
+	type Config struct {
+		Allow []string
+		Port  int
+		Tags  map[string]string
+	}
+	c := Config{
+		Allow: []string{"a"},
+		Port:  80,
+		Tags:  map[string]string{"env": "dev", "team": "x"},
+	}
+	input := strings.Join([]string{
+		`Allow = !reset`,
+		`Allow = ["b"]`,
+		`Port = !reset`,
+		`Tags {`,
+		`  env = !reset`,
+		`  region = "us"`,
+		`}`,
+	}, "\n")
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.DeepEqual(t, c, Config{
+		Allow: []string{"b"},
+		Tags:  map[string]string{"team": "x", "region": "us"},
+	})
+}
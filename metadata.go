@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/icholy/config/token"
+)
+
+// Key is a key path and the position of its entry
+type Key struct {
+	Path string
+	Pos  token.Pos
+}
+
+// String returns the position and path
+func (k Key) String() string {
+	return fmt.Sprintf("%s: %s", k.Pos, k.Path)
+}
+
+// Metadata describes how the entries of the input were used
+type Metadata struct {
+	// Keys contains the keys which were decoded
+	Keys []Key
+	// Unused contains the keys which did not match any struct field.
+	// It's only populated when unknown fields are allowed.
+	Unused []Key
+}
+
+// sort orders the keys by their position
+func (m *Metadata) sort() {
+	for _, keys := range [][]Key{m.Keys, m.Unused} {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].Pos.Offset < keys[j].Pos.Offset
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/icholy/config/token"
+)
+
+func TestMetadata(t *testing.T) {
+	input := "Addr = \":80\"\nAdrr = \":81\"\nService { Name = \"a\" }\nService { Name = \"b\"\nPort = 1 }\nTags { x = 1 }"
+	var c struct {
+		Addr    string
+		Service []struct {
+			Name string
+		}
+		Tags map[string]int
+	}
+
+	var d Decoder
+	err := d.Unmarshal([]byte(input), &c)
+	assert.Error(t, err, "2:1: no matching field: \"Adrr\"\n5:1: Service[1]: no matching field: \"Port\"")
+
+	d.DisallowUnknownFields(false)
+	err = d.Unmarshal([]byte(input), &c)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, d.Metadata(), Metadata{
+		Keys: []Key{
+			{Path: "Addr", Pos: token.Pos{Line: 1, Column: 1, Offset: 0}},
+			{Path: "Service[0]", Pos: token.Pos{Line: 3, Column: 1, Offset: 26}},
+			{Path: "Service[0].Name", Pos: token.Pos{Line: 3, Column: 11, Offset: 36}},
+			{Path: "Service[1]", Pos: token.Pos{Line: 4, Column: 1, Offset: 49}},
+			{Path: "Service[1].Name", Pos: token.Pos{Line: 4, Column: 11, Offset: 59}},
+			{Path: "Tags", Pos: token.Pos{Line: 6, Column: 1, Offset: 81}},
+			{Path: "Tags.x", Pos: token.Pos{Line: 6, Column: 8, Offset: 88}},
+		},
+		Unused: []Key{
+			{Path: "Adrr", Pos: token.Pos{Line: 2, Column: 1, Offset: 13}},
+			{Path: "Service[1].Port", Pos: token.Pos{Line: 5, Column: 1, Offset: 70}},
+		},
+	})
+	assert.Equal(t, d.Metadata().Unused[0].String(), "2:1: Adrr")
+}
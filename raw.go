@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/icholy/config/ast"
+)
+
+// RawValue is an undecoded value. Decoding into a RawValue stores the ast value,
+// which keeps its positions, so it can be decoded later once its type is known.
+type RawValue struct {
+	Value ast.Value
+	d     *Decoder // the options of the decoder which captured the value
+	path  string   // the key path of the value
+}
+
+var rawValueType = reflect.TypeOf(RawValue{})
+
+// raw returns a RawValue which decodes v with a copy of d's options
+func (d *Decoder) raw(v ast.Value, path string) RawValue {
+	opts := *d
+	opts.r = nil
+	opts.meta = Metadata{}
+	opts.positions = nil
+	opts.entryPositions = nil
+	return RawValue{Value: v, d: &opts, path: path}
+}
+
+// Decode stores the value in the value pointed to by v using the options of
+// the decoder which captured it. Error paths are relative to the whole document.
+// Decoding a zero RawValue leaves v untouched.
+func (r RawValue) Decode(v interface{}) error {
+	if r.Value == nil {
+		return nil
+	}
+	var d Decoder
+	if r.d != nil {
+		d = *r.d
+	}
+	d.positions = map[interface{}]ast.Value{}
+	d.entryPositions = map[mapEntry]map[offset]ast.Value{}
+	return d.decodeAt(r.Value, v, r.path)
+}
+
+// Union decodes raw blocks into the type registered for the value of their Key entry.
+// The zero value has no registered types.
+type Union struct {
+	// Key is the name of the entry which selects the type, e.g. Type.
+	// It's matched like a field name, including aliases when the decoder
+	// has MatchAliases enabled, and it must not be repeated. The entry is
+	// decoded into the selected type if it has a matching field, and skipped otherwise.
+	Key   string
+	types map[string]reflect.Type
+}
+
+// Register associates the name with the type of v. If v is a pointer,
+// its element type is used.
+func (u *Union) Register(name string, v interface{}) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if u.types == nil {
+		u.types = map[string]reflect.Type{}
+	}
+	u.types[name] = t
+}
+
+// Decode decodes the block into a new value of the type selected by its Key entry
+// and returns a pointer to it. The result is nil if r is a zero RawValue.
+func (u *Union) Decode(r RawValue) (interface{}, error) {
+	if r.Value == nil {
+		return nil, nil
+	}
+	b, ok := r.Value.(*ast.Block)
+	if !ok {
+		return nil, r.errors(unionError(r.Value, r.path, fmt.Errorf("expecting a block with a %q key", u.Key)))
+	}
+	// the key is matched like a field name
+	names := []string{u.Key}
+	if r.d != nil && r.d.aliases {
+		names = append(names, aliases(u.Key)...)
+	}
+	var key *ast.Entry
+	for _, e := range b.Entries {
+		if !contains(names, e.Name.Value) {
+			continue
+		}
+		if key != nil {
+			err := fmt.Errorf("duplicate key %q, previously declared at %s", e.Name.Value, key.Name.Start)
+			return nil, r.errors(keyError(e, r.path, err))
+		}
+		key = e
+	}
+	if key == nil {
+		return nil, r.errors(requiredError(b, r.path, u.Key))
+	}
+	path := joinPath(r.path, u.Key)
+	s, ok := key.Value.(*ast.String)
+	if !ok {
+		return nil, r.errors(typeError(key.Value, reflect.ValueOf(""), path))
+	}
+	t, ok := u.types[s.Value]
+	if !ok {
+		return nil, r.errors(unionError(s, path, fmt.Errorf("unknown type %q", s.Value)))
+	}
+	if t.Kind() == reflect.Struct {
+		if _, ok := cachedFields(t).byName(key.Name.Value, r.d != nil && r.d.aliases); !ok {
+			b = withoutEntry(b, key)
+		}
+	}
+	v := reflect.New(t).Interface()
+	r.Value = b
+	if err := r.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// DecodeType decodes the value into a new value of the type registered with the
+// name and returns a pointer to it. It's used when the type is selected by a
+// sibling of the value instead of an entry inside it.
+func (u *Union) DecodeType(name string, r RawValue) (interface{}, error) {
+	if r.Value == nil {
+		return nil, nil
+	}
+	t, ok := u.types[name]
+	if !ok {
+		return nil, r.errors(unionError(r.Value, r.path, fmt.Errorf("unknown type %q", name)))
+	}
+	v := reflect.New(t).Interface()
+	if err := r.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// errors converts err into an ErrorList using the capturing decoder's limit
+func (r RawValue) errors(err error) error {
+	if r.d == nil {
+		var d Decoder
+		return d.errors(err)
+	}
+	return r.d.errors(err)
+}
+
+// withoutEntry returns a copy of the block without the entry
+func withoutEntry(b *ast.Block, entry *ast.Entry) *ast.Block {
+	cp := *b
+	cp.Entries = make([]*ast.Entry, 0, len(b.Entries))
+	for _, e := range b.Entries {
+		if e != entry {
+			cp.Entries = append(cp.Entries, e)
+		}
+	}
+	return &cp
+}
+
+// contains returns true if the name is in the list
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
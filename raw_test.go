@@ -0,0 +1,145 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/icholy/config/ast"
+)
+
+type httpPlugin struct {
+	Addr  string `validate:"nonempty"`
+	Level Level
+}
+
+type execPlugin struct {
+	Type    string
+	Command []string
+}
+
+func TestRawValue(t *testing.T) {
+	type Plugin struct {
+		Type   string
+		Config RawValue
+	}
+	input := strings.Join([]string{
+		`Plugin {`,
+		`  Type = "http"`,
+		`  Config = { Addr = ":80", Level = "info" }`,
+		`}`,
+		`Plugin {`,
+		`  Type = "http"`,
+		`  Config = { Addr = "", Level = "trace" }`,
+		`}`,
+		`Plugin {`,
+		`  Type = "http"`,
+		`  Config = { Addr = "" }`,
+		`}`,
+		`Plugin {`,
+		`  Type = "none"`,
+		`}`,
+	}, "\n")
+	var d Decoder
+	d.ValidateOnDecode(true)
+	var c struct {
+		Plugin []Plugin
+	}
+	assert.NilError(t, d.Unmarshal([]byte(input), &c))
+	assert.Equal(t, len(c.Plugin), 4)
+
+	raw := c.Plugin[0].Config
+	b, ok := raw.Value.(*ast.Block)
+	assert.Assert(t, ok)
+	assert.Equal(t, b.Start.String(), "3:12")
+
+	var h httpPlugin
+	assert.NilError(t, raw.Decode(&h))
+	assert.DeepEqual(t, h, httpPlugin{Addr: ":80", Level: 1})
+
+	err := c.Plugin[1].Config.Decode(&h)
+	assert.Error(t, err, `7:33: Plugin[1].Config.Level: invalid level: "trace"`)
+
+	err = c.Plugin[1].Config.Decode(&struct{ Addr string }{})
+	assert.Error(t, err, `7:25: Plugin[1].Config: no matching field: "Level"`)
+
+	err = c.Plugin[2].Config.Decode(&httpPlugin{})
+	assert.Error(t, err, `11:21: Plugin[2].Config.Addr: must not be empty`)
+
+	assert.NilError(t, c.Plugin[3].Config.Decode(&h))
+	assert.Assert(t, c.Plugin[3].Config.Value == nil)
+
+	_, err = Marshal(c)
+	assert.Error(t, err, "Config: cannot marshal config.RawValue")
+}
+
+func TestUnion(t *testing.T) {
+	u := Union{Key: "Type"}
+	u.Register("http", httpPlugin{})
+	u.Register("exec", &execPlugin{})
+	input := strings.Join([]string{
+		`Plugin = { Type = "http", Addr = ":80" }`,
+		`Plugin = { Type = "exec", Command = ["ls"] }`,
+		`Plugin = { Addr = ":80" }`,
+		`Plugin = { Type = "none" }`,
+		`Plugin = { Type = 1 }`,
+		`Plugin = { Type = "http", Port = 1 }`,
+		`Plugin = { Type = "http", Type = "exec" }`,
+	}, "\n")
+	var c struct {
+		Plugin []RawValue
+	}
+	assert.NilError(t, Unmarshal([]byte(input), &c))
+	assert.Equal(t, len(c.Plugin), 7)
+
+	v, err := u.Decode(c.Plugin[0])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, v, &httpPlugin{Addr: ":80"})
+
+	v, err = u.Decode(c.Plugin[1])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, v, &execPlugin{Type: "exec", Command: []string{"ls"}})
+
+	messages := []string{
+		`3:10: Plugin[2]: missing required key "Type"`,
+		`4:19: Plugin[3].Type: unknown type "none"`,
+		`5:19: cannot assign 1 to Plugin[4].Type, expecting string`,
+		`6:27: Plugin[5]: no matching field: "Port"`,
+		`7:27: Plugin[6]: duplicate key "Type", previously declared at 7:12`,
+	}
+	for i, message := range messages {
+		_, err := u.Decode(c.Plugin[i+2])
+		assert.Error(t, err, message)
+	}
+
+	var single struct {
+		Plugin RawValue
+	}
+	assert.NilError(t, Unmarshal([]byte("Plugin = 1"), &single))
+	_, err = u.Decode(single.Plugin)
+	assert.Error(t, err, `1:10: Plugin: expecting a block with a "Type" key`)
+
+	v, err = u.DecodeType("exec", c.Plugin[1])
+	assert.NilError(t, err)
+	assert.Equal(t, reflect.TypeOf(v), reflect.TypeOf(&execPlugin{}))
+
+	_, err = u.DecodeType("none", c.Plugin[0])
+	assert.Error(t, err, `1:10: Plugin[0]: unknown type "none"`)
+
+	var d Decoder
+	d.MatchAliases(true)
+	input = "Plugin = { type = \"http\", addr = \":80\" }\nPlugin = { Type = \"http\", type = \"exec\" }"
+	c.Plugin = nil
+	assert.NilError(t, d.Unmarshal([]byte(input), &c))
+	v, err = u.Decode(c.Plugin[0])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, v, &httpPlugin{Addr: ":80"})
+	_, err = u.Decode(c.Plugin[1])
+	assert.Error(t, err, `2:27: Plugin[1]: duplicate key "type", previously declared at 2:12`)
+
+	v, err = u.Decode(RawValue{})
+	assert.NilError(t, err)
+	assert.Assert(t, v == nil)
+}
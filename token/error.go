@@ -0,0 +1,75 @@
+package token
+
+import (
+	"sort"
+	"strings"
+)
+
+// ErrorList is a list of errors sorted by position.
+// Errors which implement the Positioner interface are ordered by
+// their position, all other errors are placed at the end.
+type ErrorList []error
+
+// Positioner is implemented by errors with a position in the input
+type Positioner interface {
+	Position() Pos
+}
+
+// Add appends err to the list. Nested lists are flattened.
+func (l *ErrorList) Add(err error) {
+	if err == nil {
+		return
+	}
+	if list, ok := err.(ErrorList); ok {
+		*l = append(*l, list...)
+		return
+	}
+	*l = append(*l, err)
+}
+
+// Sort sorts the list by position, errors from the same file are kept together
+func (l ErrorList) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		pi, iok := l[i].(Positioner)
+		pj, jok := l[j].(Positioner)
+		if !iok || !jok {
+			return iok && !jok
+		}
+		a, b := pi.Position(), pj.Position()
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// Truncate returns the first n errors. If n <= 0, the list is returned unchanged.
+func (l ErrorList) Truncate(n int) ErrorList {
+	if n <= 0 || len(l) <= n {
+		return l
+	}
+	return l[:n]
+}
+
+// Err returns the sorted list as an error, or nil if the list is empty
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	l.Sort()
+	return l
+}
+
+// Error implements the error interface
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors in the list
+func (l ErrorList) Unwrap() []error {
+	return l
+}
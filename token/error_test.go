@@ -0,0 +1,42 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type posError struct {
+	pos Pos
+}
+
+func (e posError) Position() Pos { return e.pos }
+func (e posError) Error() string { return fmt.Sprintf("%s: error", e.pos) }
+
+func TestErrorList(t *testing.T) {
+	var list ErrorList
+	list.Add(nil)
+	assert.NilError(t, list.Err())
+	plain := errors.New("plain")
+	list.Add(posError{Pos{3, 1, 20, ""}})
+	list.Add(plain)
+	list.Add(ErrorList{
+		posError{Pos{1, 5, 4, ""}},
+		posError{Pos{2, 1, 10, ""}},
+	})
+	err := list.Err()
+	assert.Error(t, err, "1:5: error\n2:1: error\n3:1: error\nplain")
+	assert.Assert(t, errors.Is(err, plain))
+	assert.Error(t, list.Truncate(2), "1:5: error\n2:1: error")
+
+	// errors from different files aren't interleaved by offset
+	list = ErrorList{
+		posError{Pos{2, 1, 10, "b.conf"}},
+		posError{Pos{3, 1, 20, "a.conf"}},
+		posError{Pos{1, 1, 0, "b.conf"}},
+		posError{Pos{1, 1, 0, "a.conf"}},
+	}
+	assert.Error(t, list.Err(), "a.conf:1:1: error\na.conf:3:1: error\nb.conf:1:1: error\nb.conf:2:1: error")
+}
@@ -9,10 +9,15 @@ import (
 // Pos is the position inside the file
 type Pos struct {
 	Line, Column, Offset int
+	Filename             string
 }
 
-// String returns the line and column as a string
+// String returns the line and column as a string.
+// If there's a filename, it's used as a prefix.
 func (p Pos) String() string {
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
 	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
@@ -34,10 +39,14 @@ func (s Span) String() string {
 	return b.String()
 }
 
-// Snip returns a snippet between start and end
+// Snip returns a snippet between start and end.
+// Offsets outside of the input are clamped to it.
 func Snip(input string, start, end Pos) Span {
 	var lines []string
-	input = string([]rune(input)[start.Offset:end.Offset])
+	data := []rune(input)
+	hi := clamp(end.Offset, 0, len(data))
+	lo := clamp(start.Offset, 0, hi)
+	input = string(data[lo:hi])
 	sc := bufio.NewScanner(strings.NewReader(input))
 	for sc.Scan() {
 		lines = append(lines, sc.Text())
@@ -47,3 +56,60 @@ func Snip(input string, start, end Pos) Span {
 		Lines: lines,
 	}
 }
+
+// clamp returns n limited to the range [lo, hi]
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
+
+// Highlight returns the lines of input containing the range between
+// start and end with the range underlined by carets.
+func Highlight(input string, start, end Pos) string {
+	data := []rune(input)
+	// extend the range to cover whole lines
+	lineStart := start
+	lineStart.Offset -= start.Column - 1
+	lineStart.Column = 1
+	lineEnd := end
+	for lineEnd.Offset < len(data) && !isNewline(data[lineEnd.Offset]) {
+		lineEnd.Offset++
+	}
+	span := Snip(input, lineStart, lineEnd)
+	var b strings.Builder
+	for i, line := range span.Lines {
+		fmt.Fprintf(&b, "%05d: %s\n", span.Start.Line+i, line)
+		text := []rune(line)
+		lo, hi := 0, len(text)
+		if i == 0 {
+			lo = start.Column - 1
+		} else {
+			for lo < len(text) && isWhite(text[lo]) {
+				lo++
+			}
+		}
+		if span.Start.Line+i == end.Line {
+			hi = end.Column - 1
+		}
+		if hi <= lo {
+			hi = lo + 1
+		}
+		b.WriteString("       ")
+		// keep tabs so the carets line up with the text
+		for j := 0; j < lo; j++ {
+			if j < len(text) && text[j] == '\t' {
+				b.WriteRune('\t')
+			} else {
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteString(strings.Repeat("^", hi-lo))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
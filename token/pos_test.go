@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"gotest.tools/v3/assert"
 	"gotest.tools/v3/golden"
 )
 
@@ -13,18 +14,24 @@ func TestSnip(t *testing.T) {
 		output     string
 	}{
 		{
-			start:  Pos{1, 1, 0},
-			end:    Pos{1, 1, 0},
+			start:  Pos{1, 1, 0, ""},
+			end:    Pos{1, 1, 0, ""},
 			output: "empty.output",
 		},
 		{
-			start:  Pos{1, 1, 0},
-			end:    Pos{11, 15, 119},
+			start:  Pos{1, 1, 0, ""},
+			end:    Pos{11, 15, 109, ""},
 			output: "full.output",
 		},
 		{
-			start:  Pos{3, 10, 19},
-			end:    Pos{3, 19, 24},
+			// offsets past the end of the input are clamped
+			start:  Pos{1, 1, 0, ""},
+			end:    Pos{11, 15, 500, ""},
+			output: "full.output",
+		},
+		{
+			start:  Pos{3, 9, 17, ""},
+			end:    Pos{3, 14, 22, ""},
 			output: "partline.output",
 		},
 	}
@@ -36,3 +43,32 @@ func TestSnip(t *testing.T) {
 		})
 	}
 }
+
+func TestHighlight(t *testing.T) {
+	input := "block {\n\tfoo = 123\n\tbar = [\n\t\t1,\n\t]\n}"
+	tests := []struct {
+		name       string
+		start, end Pos
+		output     string
+	}{
+		{
+			name:   "SingleLine",
+			start:  Pos{2, 8, 15, ""},
+			end:    Pos{2, 11, 18, ""},
+			output: "00002: \tfoo = 123\n       \t      ^^^\n",
+		},
+		{
+			name:  "MultiLine",
+			start: Pos{3, 8, 26, ""},
+			end:   Pos{5, 3, 34, ""},
+			output: "00003: \tbar = [\n       \t      ^\n" +
+				"00004: \t\t1,\n       \t\t^^\n" +
+				"00005: \t]\n       \t^\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Highlight(input, tt.start, tt.end), tt.output)
+		})
+	}
+}
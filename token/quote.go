@@ -0,0 +1,133 @@
+package token
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Unquote interprets text as a quoted, raw, or heredoc string literal
+// and returns the string value it represents.
+func Unquote(text string) (string, error) {
+	n := len(text)
+	switch {
+	case n >= 2 && text[0] == '"' && text[n-1] == '"':
+		return unescape(text[1 : n-1])
+	case n >= 2 && text[0] == '`' && text[n-1] == '`':
+		return strings.ReplaceAll(text[1:n-1], "\r", ""), nil
+	case strings.HasPrefix(text, "<<"):
+		return heredoc(text)
+	default:
+		return "", fmt.Errorf("invalid string literal: %s", text)
+	}
+}
+
+// unescape interprets the Go escape sequences in s.
+// A \0 which isn't followed by two more octal digits is a NUL character.
+func unescape(s string) (string, error) {
+	var b strings.Builder
+	for len(s) > 0 {
+		if s[0] != '\\' {
+			i := strings.IndexByte(s, '\\')
+			if i == -1 {
+				i = len(s)
+			}
+			b.WriteString(s[:i])
+			s = s[i:]
+			continue
+		}
+		if strings.HasPrefix(s, `\0`) && !(len(s) >= 4 && isOctalDigit(s[2]) && isOctalDigit(s[3])) {
+			b.WriteByte(0)
+			s = s[2:]
+			continue
+		}
+		value, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return "", fmt.Errorf("invalid escape sequence: %s", escapeAt(s))
+		}
+		if multibyte {
+			b.WriteRune(value)
+		} else {
+			// \x and octal escapes are single bytes
+			b.WriteByte(byte(value))
+		}
+		s = tail
+	}
+	return b.String(), nil
+}
+
+// escapeAt returns the escape sequence at the start of s for error messages
+func escapeAt(s string) string {
+	n := 2
+	switch {
+	case strings.HasPrefix(s, `\x`):
+		n = 4
+	case strings.HasPrefix(s, `\u`):
+		n = 6
+	case strings.HasPrefix(s, `\U`):
+		n = 10
+	case len(s) > 1 && isOctalDigit(s[1]):
+		n = 4
+	}
+	if n > len(s) {
+		n = len(s)
+	}
+	return s[:n]
+}
+
+// isOctalDigit returns true if ch is an octal digit
+func isOctalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '7'
+}
+
+// heredoc returns the body of a heredoc literal. The body of an
+// indented heredoc, <<-EOT, has the common leading whitespace removed.
+func heredoc(text string) (string, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	if len(lines) < 2 {
+		return "", fmt.Errorf("invalid heredoc: %s", text)
+	}
+	marker := strings.TrimPrefix(lines[0], "<<")
+	indented := strings.HasPrefix(marker, "-")
+	marker = strings.TrimPrefix(marker, "-")
+	if marker == "" || strings.TrimSpace(lines[len(lines)-1]) != marker {
+		return "", fmt.Errorf("invalid heredoc: %s", text)
+	}
+	body := lines[1 : len(lines)-1]
+	if indented {
+		body = dedent(body)
+	}
+	var b strings.Builder
+	for _, line := range body {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// dedent removes the longest common whitespace prefix from all non-blank lines
+func dedent(lines []string) []string {
+	prefix, first := "", true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+		if strings.TrimSpace(out[i]) == "" {
+			out[i] = ""
+		}
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package token
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestUnquoteError(t *testing.T) {
+	tests := []struct {
+		text    string
+		message string
+	}{
+		{`"\q"`, `invalid escape sequence: \q`},
+		{`"\'"`, `invalid escape sequence: \'`},
+		{`"\x4"`, `invalid escape sequence: \x4`},
+		{`"\uD800"`, `invalid escape sequence: \uD800`},
+		{`"\18"`, `invalid escape sequence: \18`},
+		{"'a'", `invalid string literal: 'a'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := Unquote(tt.text)
+			assert.Error(t, err, tt.message)
+		})
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		text  string
+		value string
+	}{
+		{`""`, ""},
+		{`"hello"`, "hello"},
+		{`"a\tb\nc\rd"`, "a\tb\nc\rd"},
+		{`"\"quoted\" \\"`, `"quoted" \`},
+		{`"\u00e9\U0001F600 é"`, "é😀 é"},
+		{`"\x41\101\0\a\b\f\v"`, "AA\x00\a\b\f\v"},
+		{"`C:\\path\\n\r\n`", `C:\path\n` + "\n"},
+		{"<<EOT\nline 1\n  line 2\nEOT", "line 1\n  line 2\n"},
+		{"<<-EOT\n    SELECT *\n\n      FROM t\n    EOT", "SELECT *\n\n  FROM t\n"},
+		{"<<EOT\r\na\r\nEOT", "a\n"},
+		{"<<EOT\nEOT", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			value, err := Unquote(tt.text)
+			assert.NilError(t, err)
+			assert.Equal(t, value, tt.value)
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package token
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -23,6 +25,8 @@ const (
 	BOOL
 	COMMENT
 	NEWLINE
+	QUANTITY
+	RESET
 )
 
 // String returns a string representation of the type
@@ -54,6 +58,10 @@ func (t Type) String() string {
 		return "COMMENT"
 	case NEWLINE:
 		return "NEWLINE"
+	case QUANTITY:
+		return "QUANTITY"
+	case RESET:
+		return "RESET"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", t)
 	}
@@ -72,20 +80,38 @@ func (t Token) String() string {
 
 // Lexer tokenizes a reader
 type Lexer struct {
-	data    []rune
-	index   int
+	r       io.RuneReader
+	buf     []rune // runes which have been peeked but not read
+	prev    rune   // the last rune read
 	current Pos
+	done    bool // the reader has been exhausted
+	err     error
 }
 
 // NewLexer constructs a Lexer instance
 func NewLexer(input string) *Lexer {
+	return NewFileLexer("", strings.NewReader(input))
+}
+
+// NewFileLexer constructs a Lexer which reads from r incrementally.
+// The filename is recorded in every token position.
+func NewFileLexer(filename string, r io.Reader) *Lexer {
+	rr, ok := r.(io.RuneReader)
+	if !ok {
+		rr = bufio.NewReader(r)
+	}
 	return &Lexer{
-		// TODO: make sure this is correct
-		data:    []rune(input),
-		current: Pos{Line: 1, Column: 1},
+		r:       rr,
+		current: Pos{Line: 1, Column: 1, Filename: filename},
 	}
 }
 
+// Err returns the first error encountered reading the input.
+// The lexer returns an EOF token after a read error.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
 // Next returns the next token
 func (l *Lexer) Next() Token {
 	if pos, ok := l.whitespace(); ok {
@@ -102,13 +128,14 @@ func (l *Lexer) Next() Token {
 			Start: pos,
 			Type:  EOF,
 		}
-	case isDigit(ch) || ch == '-':
+	case isDigit(ch) || ch == '-' || ch == '+' || (ch == '.' && isDigit(l.lookahead(1))):
+		text, typ := l.number()
 		return Token{
 			Start: pos,
-			Type:  NUMBER,
-			Text:  l.number(),
+			Type:  typ,
+			Text:  text,
 		}
-	case ch == '"':
+	case ch == '"' || ch == '`' || (ch == '<' && l.lookahead(1) == '<'):
 		text, ok := l.string()
 		if !ok {
 			return l.invalid(pos, text)
@@ -125,6 +152,16 @@ func (l *Lexer) Next() Token {
 			Type:  IDENT,
 			Text:  text,
 		}
+	case ch == '!':
+		text := string(l.read()) + l.ident()
+		if text != "!reset" {
+			return l.invalid(pos, text)
+		}
+		return Token{
+			Start: pos,
+			Type:  RESET,
+			Text:  text,
+		}
 	case ch == '/':
 		text, ok := l.comment()
 		if !ok {
@@ -152,13 +189,38 @@ func (l *Lexer) Next() Token {
 	}
 }
 
+// Pos returns the position of the next rune
+func (l *Lexer) Pos() Pos {
+	return l.current
+}
+
 // eof is a sentinel value used in place of a rune when we're
 // at the end of the input
 const eof = 0x00
 
+// fill makes sure there are at least n runes in the lookahead buffer.
+// It returns false if the input doesn't have enough runes.
+func (l *Lexer) fill(n int) bool {
+	for len(l.buf) < n {
+		if l.done {
+			return false
+		}
+		ch, _, err := l.r.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			l.done = true
+			return false
+		}
+		l.buf = append(l.buf, ch)
+	}
+	return true
+}
+
 // eof returns true when we're at the end of file
 func (l *Lexer) eof() bool {
-	return l.index >= len(l.data)
+	return !l.fill(1)
 }
 
 // newline returns true if the next character is a newline
@@ -171,10 +233,11 @@ func (l *Lexer) read() rune {
 	if l.eof() {
 		return eof
 	}
-	ch := l.data[l.index]
+	ch := l.buf[0]
+	l.buf = l.buf[1:]
 	if isNewline(ch) {
 		// handle CRLF
-		if !(l.index > 0 && ch == '\n' && l.data[l.index-1] == '\r') {
+		if !(ch == '\n' && l.prev == '\r') {
 			l.current.Line++
 			l.current.Column = 1
 		}
@@ -182,7 +245,7 @@ func (l *Lexer) read() rune {
 		l.current.Column++
 	}
 	l.current.Offset++
-	l.index++
+	l.prev = ch
 	return ch
 }
 
@@ -191,7 +254,7 @@ func (l *Lexer) peek() rune {
 	if l.eof() {
 		return eof
 	}
-	return l.data[l.index]
+	return l.buf[0]
 }
 
 // expect checks if the next rune is equal to ch.
@@ -238,49 +301,202 @@ func (l *Lexer) invalid(pos Pos, text string) Token {
 	}
 }
 
-// number reads a number literal
-func (l *Lexer) number() string {
+// number reads a number literal. Numbers directly followed by a
+// unit, like 30s or 512KiB, are returned as a QUANTITY.
+// Malformed numbers are returned as INVALID.
+func (l *Lexer) number() (string, Type) {
 	var text strings.Builder
-	if l.peek() == '-' || l.peek() == '+' {
+	if ch := l.peek(); ch == '-' || ch == '+' {
 		text.WriteRune(l.read())
 	}
-	for isDigit(l.peek()) || l.peek() == '.' {
+	if isAlpha(l.peek()) {
+		// signed inf, nan doesn't have a sign
+		word := l.ident()
+		text.WriteString(word)
+		if word == "inf" {
+			return text.String(), NUMBER
+		}
+		return text.String(), INVALID
+	}
+	typ := NUMBER
+	if l.peek() == '0' && isBase(l.lookahead(1)) {
 		text.WriteRune(l.read())
+		base := l.read()
+		text.WriteRune(base)
+		n, ok := l.digits(&text, digitFunc(base), true)
+		if !ok || n == 0 {
+			typ = INVALID
+		}
+	} else {
+		n, ok := l.digits(&text, isDigit, false)
+		integer := text.String()
+		if !ok {
+			typ = INVALID
+		}
+		if l.peek() == '.' {
+			text.WriteRune(l.read())
+			m, ok := l.digits(&text, isDigit, false)
+			if !ok {
+				typ = INVALID
+			}
+			n += m
+			integer = ""
+		}
+		if n == 0 {
+			typ = INVALID
+		}
+		exponent := l.exponent()
+		if exponent {
+			text.WriteRune(l.read())
+			if ch := l.peek(); ch == '-' || ch == '+' {
+				text.WriteRune(l.read())
+			}
+			if _, ok := l.digits(&text, isDigit, false); !ok {
+				typ = INVALID
+			}
+			integer = ""
+		}
+		if !octalOK(integer) {
+			typ = INVALID
+		}
+		if typ == NUMBER && !exponent && isUnit(l.peek()) {
+			// compound durations like 1h30m alternate between numbers and units
+			for ch := l.peek(); isUnit(ch) || isDigit(ch) || ch == '.'; ch = l.peek() {
+				text.WriteRune(l.read())
+			}
+			typ = QUANTITY
+		}
 	}
-	return text.String()
+	// anything directly following the literal makes it malformed
+	for ch := l.peek(); isAlpha(ch) || isDigit(ch) || ch == '.' || ch == '_'; ch = l.peek() {
+		text.WriteRune(l.read())
+		typ = INVALID
+	}
+	return text.String(), typ
+}
+
+// digits reads a sequence of digits accepted by fn. Single underscores can separate
+// digits, or follow a base prefix. It returns the number of digits read and false
+// if an underscore is misplaced.
+func (l *Lexer) digits(text *strings.Builder, fn func(rune) bool, prefixed bool) (int, bool) {
+	n, ok := 0, true
+	underscore := false
+	for {
+		ch := l.peek()
+		switch {
+		case fn(ch):
+			n++
+			underscore = false
+		case ch == '_':
+			if underscore || (n == 0 && !prefixed) {
+				ok = false
+			}
+			underscore = true
+		default:
+			return n, ok && !underscore
+		}
+		text.WriteRune(l.read())
+	}
+}
+
+// exponent returns true if the next runes are an exponent marker followed by
+// an optionally signed digit
+func (l *Lexer) exponent() bool {
+	if ch := l.peek(); ch != 'e' && ch != 'E' {
+		return false
+	}
+	ch := l.lookahead(1)
+	if ch == '-' || ch == '+' {
+		ch = l.lookahead(2)
+	}
+	return isDigit(ch)
 }
 
-// string reads a string literal
+// lookahead returns the rune i positions after the next one without advancing
+func (l *Lexer) lookahead(i int) rune {
+	if !l.fill(i + 1) {
+		return eof
+	}
+	return l.buf[i]
+}
+
+// string reads a quoted, raw, or heredoc string literal. The returned text
+// includes the delimiters. The second return value is false if the string is not terminated.
 func (l *Lexer) string() (string, bool) {
-	l.read()
-	var escaped bool
+	switch l.peek() {
+	case '`':
+		return l.raw()
+	case '<':
+		return l.heredoc()
+	}
 	var text strings.Builder
+	text.WriteRune(l.read())
 	for !l.eof() {
-		ch := l.peek()
-		if escaped {
-			switch ch {
-			case 't':
-				text.WriteByte('\t')
-			case 'r':
-				text.WriteByte('\r')
-			case 'n':
-				text.WriteByte('\n')
-			default:
-				text.WriteRune(ch)
-			}
-			escaped = false
-		} else {
-			if ch == '"' {
-				l.read()
-				return text.String(), true
-			}
-			if ch == '\\' {
-				escaped = true
-			} else {
-				text.WriteRune(ch)
+		ch := l.read()
+		text.WriteRune(ch)
+		switch ch {
+		case '"':
+			return text.String(), true
+		case '\\':
+			if !l.eof() {
+				text.WriteRune(l.read())
 			}
 		}
-		l.read()
+	}
+	return text.String(), false
+}
+
+// raw reads a backtick delimited string literal
+func (l *Lexer) raw() (string, bool) {
+	var text strings.Builder
+	text.WriteRune(l.read())
+	for !l.eof() {
+		ch := l.read()
+		text.WriteRune(ch)
+		if ch == '`' {
+			return text.String(), true
+		}
+	}
+	return text.String(), false
+}
+
+// heredoc reads a heredoc string literal like:
+//
+//	<<EOT
+//	text
+//	EOT
+//
+// The closing marker must be on a line by itself, optionally indented.
+func (l *Lexer) heredoc() (string, bool) {
+	var text strings.Builder
+	text.WriteRune(l.read())
+	text.WriteRune(l.read())
+	if l.peek() == '-' {
+		text.WriteRune(l.read())
+	}
+	if !isAlpha(l.peek()) {
+		return text.String(), false
+	}
+	marker := l.ident()
+	text.WriteString(marker)
+	if !l.newline() {
+		return text.String(), false
+	}
+	for !l.eof() {
+		// newline preceding the line
+		ch := l.read()
+		text.WriteRune(ch)
+		if ch == '\r' && l.peek() == '\n' {
+			text.WriteRune(l.read())
+		}
+		var line strings.Builder
+		for !l.eof() && !l.newline() {
+			line.WriteRune(l.read())
+		}
+		text.WriteString(line.String())
+		if strings.TrimSpace(line.String()) == marker {
+			return text.String(), true
+		}
 	}
 	return text.String(), false
 }
@@ -323,6 +539,46 @@ func isAlpha(ch rune) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
 }
 
+// isBase returns true if ch is a base prefix character following a 0
+func isBase(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	default:
+		return false
+	}
+}
+
+// digitFunc returns a function which checks for digits in the base denoted by ch
+func digitFunc(base rune) func(rune) bool {
+	switch base {
+	case 'x', 'X':
+		return func(ch rune) bool {
+			return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+		}
+	case 'o', 'O':
+		return func(ch rune) bool { return '0' <= ch && ch <= '7' }
+	default:
+		return func(ch rune) bool { return ch == '0' || ch == '1' }
+	}
+}
+
+// octalOK returns false if text is a legacy octal integer, like 0755,
+// which contains the digits 8 or 9
+func octalOK(text string) bool {
+	text = strings.TrimLeft(text, "+-")
+	if len(text) < 2 || text[0] != '0' {
+		return true
+	}
+	return !strings.ContainsAny(text, "89")
+}
+
+// isUnit returns true if ch can appear in a unit suffix.
+// The micro sign is included because time.Duration uses it.
+func isUnit(ch rune) bool {
+	return isAlpha(ch) || ch == 'µ' || ch == 'μ'
+}
+
 // isWhite returns true if ch is whitespace
 func isWhite(ch rune) bool {
 	return ch == ' ' || ch == '\t' || isNewline(ch)
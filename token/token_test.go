@@ -1,7 +1,9 @@
 package token
 
 import (
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"gotest.tools/v3/assert"
 )
@@ -17,102 +19,170 @@ func TestLexer(t *testing.T) {
 			name:  "EOF",
 			input: "",
 			expect: []Token{
-				{Pos{1, 1, 0}, EOF, ""},
+				{Pos{1, 1, 0, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "Int",
 			input: "42",
 			expect: []Token{
-				{Pos{1, 1, 0}, NUMBER, "42"},
-				{Pos{1, 3, 2}, EOF, ""},
+				{Pos{1, 1, 0, ""}, NUMBER, "42"},
+				{Pos{1, 3, 2, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "NegativeInt",
 			input: "-42",
 			expect: []Token{
-				{Pos{1, 1, 0}, NUMBER, "-42"},
-				{Pos{1, 4, 3}, EOF, ""},
+				{Pos{1, 1, 0, ""}, NUMBER, "-42"},
+				{Pos{1, 4, 3, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "Float",
 			input: "3.14159265359",
 			expect: []Token{
-				{Pos{1, 1, 0}, NUMBER, "3.14159265359"},
-				{Pos{1, 14, 13}, EOF, ""},
+				{Pos{1, 1, 0, ""}, NUMBER, "3.14159265359"},
+				{Pos{1, 14, 13, ""}, EOF, ""},
+			},
+		},
+		{
+			name:  "Duration",
+			input: "1h30m",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, QUANTITY, "1h30m"},
+				{Pos{1, 6, 5, ""}, EOF, ""},
+			},
+		},
+		{
+			name:  "Size",
+			input: "1.5GiB,",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, QUANTITY, "1.5GiB"},
+				{Pos{1, 7, 6, ""}, COMMA, ","},
+				{Pos{1, 8, 7, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "String",
 			input: `"hello world"`,
 			expect: []Token{
-				{Pos{1, 1, 0}, STRING, "hello world"},
-				{Pos{1, 14, 13}, EOF, ""},
+				{Pos{1, 1, 0, ""}, STRING, `"hello world"`},
+				{Pos{1, 14, 13, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "BadString",
 			input: `"whoops`,
 			expect: []Token{
-				{Pos{1, 1, 0}, INVALID, "whoops"},
+				{Pos{1, 1, 0, ""}, INVALID, `"whoops`},
+			},
+		},
+		{
+			name:  "EscapedQuote",
+			input: `"a\"b"`,
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, STRING, `"a\"b"`},
+				{Pos{1, 7, 6, ""}, EOF, ""},
+			},
+		},
+		{
+			name:  "RawString",
+			input: "`a\\\nb`",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, STRING, "`a\\\nb`"},
+				{Pos{2, 3, 6, ""}, EOF, ""},
+			},
+		},
+		{
+			name:  "BadRawString",
+			input: "`whoops",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, INVALID, "`whoops"},
+			},
+		},
+		{
+			name:  "Reset",
+			input: "a = !reset\n!foo",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, IDENT, "a"},
+				{Pos{1, 3, 2, ""}, ASSIGN, "="},
+				{Pos{1, 5, 4, ""}, RESET, "!reset"},
+				{Pos{1, 11, 10, ""}, NEWLINE, ""},
+				{Pos{2, 1, 11, ""}, INVALID, "!foo"},
+			},
+		},
+		{
+			name:  "Heredoc",
+			input: "<<-EOT\n  a\n  EOT\nx",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, STRING, "<<-EOT\n  a\n  EOT"},
+				{Pos{3, 6, 16, ""}, NEWLINE, ""},
+				{Pos{4, 1, 17, ""}, IDENT, "x"},
+				{Pos{4, 2, 18, ""}, EOF, ""},
+			},
+		},
+		{
+			name:  "UnterminatedHeredoc",
+			input: "<<EOT\na\nEOTX",
+			expect: []Token{
+				{Pos{1, 1, 0, ""}, INVALID, "<<EOT\na\nEOTX"},
 			},
 		},
 		{
 			name:  "Assign",
 			input: "=",
 			expect: []Token{
-				{Pos{1, 1, 0}, ASSIGN, "="},
-				{Pos{1, 2, 1}, EOF, ""},
+				{Pos{1, 1, 0, ""}, ASSIGN, "="},
+				{Pos{1, 2, 1, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "Ident",
 			input: "key",
 			expect: []Token{
-				{Pos{1, 1, 0}, IDENT, "key"},
-				{Pos{1, 4, 3}, EOF, ""},
+				{Pos{1, 1, 0, ""}, IDENT, "key"},
+				{Pos{1, 4, 3, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "LineComment",
 			input: "// this is a comment",
 			expect: []Token{
-				{Pos{1, 1, 0}, COMMENT, "// this is a comment"},
-				{Pos{1, 21, 20}, EOF, ""},
+				{Pos{1, 1, 0, ""}, COMMENT, "// this is a comment"},
+				{Pos{1, 21, 20, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "Block",
 			input: "block { }",
 			expect: []Token{
-				{Pos{1, 1, 0}, IDENT, "block"},
-				{Pos{1, 7, 6}, LBRACE, "{"},
-				{Pos{1, 9, 8}, RBRACE, "}"},
-				{Pos{1, 10, 9}, EOF, ""},
+				{Pos{1, 1, 0, ""}, IDENT, "block"},
+				{Pos{1, 7, 6, ""}, LBRACE, "{"},
+				{Pos{1, 9, 8, ""}, RBRACE, "}"},
+				{Pos{1, 10, 9, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "Newline",
 			input: "foo = true\nbar",
 			expect: []Token{
-				{Pos{1, 1, 0}, IDENT, "foo"},
-				{Pos{1, 5, 4}, ASSIGN, "="},
-				{Pos{1, 7, 6}, IDENT, "true"},
-				{Pos{1, 11, 10}, NEWLINE, ""},
-				{Pos{2, 1, 11}, IDENT, "bar"},
-				{Pos{2, 4, 14}, EOF, ""},
+				{Pos{1, 1, 0, ""}, IDENT, "foo"},
+				{Pos{1, 5, 4, ""}, ASSIGN, "="},
+				{Pos{1, 7, 6, ""}, IDENT, "true"},
+				{Pos{1, 11, 10, ""}, NEWLINE, ""},
+				{Pos{2, 1, 11, ""}, IDENT, "bar"},
+				{Pos{2, 4, 14, ""}, EOF, ""},
 			},
 		},
 		{
 			name:  "CRLF",
 			input: "foo\r\nbar",
 			expect: []Token{
-				{Pos{1, 1, 0}, IDENT, "foo"},
-				{Pos{1, 4, 3}, NEWLINE, ""},
-				{Pos{2, 1, 5}, IDENT, "bar"},
-				{Pos{2, 4, 8}, EOF, ""},
+				{Pos{1, 1, 0, ""}, IDENT, "foo"},
+				{Pos{1, 4, 3, ""}, NEWLINE, ""},
+				{Pos{2, 1, 5, ""}, IDENT, "bar"},
+				{Pos{2, 4, 8, ""}, EOF, ""},
 			},
 		},
 	}
@@ -134,3 +204,79 @@ func TestLexer(t *testing.T) {
 		})
 	}
 }
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		input string
+		typ   Type
+		text  string
+	}{
+		{"1e6", NUMBER, "1e6"},
+		{"-2.5E-3", NUMBER, "-2.5E-3"},
+		{"+1", NUMBER, "+1"},
+		{".5", NUMBER, ".5"},
+		{"1.", NUMBER, "1."},
+		{"0x1F", NUMBER, "0x1F"},
+		{"0X_ff", NUMBER, "0X_ff"},
+		{"0o755", NUMBER, "0o755"},
+		{"0755", NUMBER, "0755"},
+		{"0b1010", NUMBER, "0b1010"},
+		{"1_000_000", NUMBER, "1_000_000"},
+		{"0.5", NUMBER, "0.5"},
+		{"089.5", NUMBER, "089.5"},
+		{"-inf", NUMBER, "-inf"},
+		{"+inf", NUMBER, "+inf"},
+		{"+nan", INVALID, "+nan"},
+		{"-nan", INVALID, "-nan"},
+		{"10MB", QUANTITY, "10MB"},
+		{"1.2.3", INVALID, "1.2.3"},
+		{"1__0", INVALID, "1__0"},
+		{"1_", INVALID, "1_"},
+		{"0x", INVALID, "0x"},
+		{"0xG", INVALID, "0xG"},
+		{"0o8", INVALID, "0o8"},
+		{"0b102", INVALID, "0b102"},
+		{"089", INVALID, "089"},
+		{"0x1Fs", INVALID, "0x1Fs"},
+		{"1e6s", INVALID, "1e6s"},
+		{"-", INVALID, "-"},
+		{"-foo", INVALID, "-foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tok := NewLexer(tt.input + " ").Next()
+			assert.Equal(t, tok.Type, tt.typ)
+			assert.Equal(t, tok.Text, tt.text)
+			assert.Equal(t, tok.Start, Pos{1, 1, 0, ""})
+		})
+	}
+}
+
+func TestFileLexer(t *testing.T) {
+	lex := NewFileLexer("test.conf", strings.NewReader("a\nb"))
+	var actual []Token
+	for {
+		tok := lex.Next()
+		actual = append(actual, tok)
+		if tok.Type == EOF {
+			break
+		}
+	}
+	assert.NilError(t, lex.Err())
+	assert.DeepEqual(t, actual, []Token{
+		{Pos{1, 1, 0, "test.conf"}, IDENT, "a"},
+		{Pos{1, 2, 1, "test.conf"}, NEWLINE, ""},
+		{Pos{2, 1, 2, "test.conf"}, IDENT, "b"},
+		{Pos{2, 2, 3, "test.conf"}, EOF, ""},
+	})
+	assert.Equal(t, actual[2].Start.String(), "test.conf:2:1")
+}
+
+func TestLexerReadError(t *testing.T) {
+	r := iotest.TimeoutReader(strings.NewReader("abc"))
+	lex := NewFileLexer("", iotest.OneByteReader(r))
+	tok := lex.Next()
+	assert.Equal(t, tok.Type, IDENT)
+	assert.Equal(t, lex.Next().Type, EOF)
+	assert.Equal(t, lex.Err(), iotest.ErrTimeout)
+}
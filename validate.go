@@ -0,0 +1,408 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/icholy/config/ast"
+	"github.com/icholy/config/token"
+)
+
+// Validator is implemented by types which validate themselves.
+// Validate is called after the validate tags of the type's fields are checked.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned when a value fails validation
+type ValidationError struct {
+	Pos   token.Pos // start of the value, the zero Pos if unknown
+	End   token.Pos // end of the value
+	Path  string    // key path, e.g. Service[1].Metrics.Addr
+	Value ast.Value // the value the field was decoded from, nil if unknown
+	Err   error
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if e.Pos.Line > 0 {
+		b.WriteString(e.Pos.String())
+		b.WriteString(": ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+// Position implements token.Positioner
+func (e *ValidationError) Position() token.Pos {
+	return e.Pos
+}
+
+// Unwrap returns the underlying error
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the lines of src containing the offending value underlined with carets.
+// The src must be the input the value was decoded from.
+func (e *ValidationError) Snippet(src []byte) string {
+	return token.Highlight(string(src), e.Pos, e.End)
+}
+
+// Validate checks the validate tags of the struct fields reachable from v
+// and calls Validate on the values implementing Validator. The tag is a comma
+// separated list of rules:
+//
+//	nonempty      the value is not zero, or has a non-zero length
+//	len=N         strings, slices, and maps have length N
+//	min=N, max=N  numbers are within the bound, or strings, slices, and maps have a
+//	              length within the bound. The bound can be a duration or a size.
+//	oneof=A B C   the value is one of the space separated options
+//	pattern=RE    strings match the regular expression. It must be the last rule
+//	              because the expression may contain commas.
+//
+// The errors are returned as an ErrorList of *ValidationError.
+func Validate(v interface{}) error {
+	vd := validator{seen: map[interface{}]bool{}}
+	vd.walk(reflect.ValueOf(v), "", nil)
+	return vd.errors.Err()
+}
+
+// Validate is like the Validate function, but errors are positioned at the
+// ast values which populated the fields during the most recent decode.
+func (d *Decoder) Validate(v interface{}) error {
+	return d.validateAt(v, "")
+}
+
+// validateAt is like Validate, but the error paths start at the key path
+func (d *Decoder) validateAt(v interface{}, path string) error {
+	vd := validator{positions: d.positions, entries: d.entryPositions, seen: map[interface{}]bool{}}
+	vd.walk(reflect.ValueOf(v), path, nil)
+	return d.errors(vd.errors.Err())
+}
+
+// validator walks a value and collects validation errors
+type validator struct {
+	positions map[interface{}]ast.Value
+	entries   map[mapEntry]map[offset]ast.Value
+	entry     mapScope             // the map value being walked
+	seen      map[interface{}]bool // pointers which have been walked
+	errors    ErrorList
+}
+
+// mapScope is the copy of a map value being walked and the positions inside it
+type mapScope struct {
+	base, size uintptr
+	positions  map[offset]ast.Value
+}
+
+// node returns the ast value which v was decoded from, or the fallback
+func (vd *validator) node(v reflect.Value, fallback ast.Value) ast.Value {
+	if v.CanAddr() {
+		p := v.Addr()
+		if node, ok := vd.positions[p.Interface()]; ok {
+			return node
+		}
+		if n, ok := within(p.Pointer(), vd.entry.base, vd.entry.size); ok && vd.entry.positions != nil {
+			if node, ok := vd.entry.positions[offset{n: n, typ: p.Type()}]; ok {
+				return node
+			}
+		}
+	}
+	return fallback
+}
+
+// fail records a validation error
+func (vd *validator) fail(node ast.Value, path string, err error) {
+	start, end := span(node)
+	vd.errors.Add(&ValidationError{
+		Pos:   start,
+		End:   end,
+		Path:  path,
+		Value: node,
+		Err:   err,
+	})
+}
+
+// walk validates v and the values it contains. The node is the ast value
+// of the closest parent, it's used when v's own position is unknown.
+func (vd *validator) walk(v reflect.Value, path string, node ast.Value) {
+	if !v.IsValid() {
+		return
+	}
+	if v.Type() == rawValueType {
+		// validated when it's decoded
+		return
+	}
+	node = vd.node(v, node)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Ptr && v.CanInterface() {
+			// don't follow cycles
+			if vd.seen[v.Interface()] {
+				return
+			}
+			vd.seen[v.Interface()] = true
+		}
+		vd.walk(v.Elem(), path, node)
+		return
+	case reflect.Struct:
+		for _, f := range cachedFields(v.Type()) {
+			fv, ok := fieldByIndexNoAlloc(v, f.index)
+			if !ok || len(f.conflicts) > 0 {
+				continue
+			}
+			p := joinPath(path, f.name)
+			fnode := vd.node(fv, node)
+			if err := checkRules(f.validate, fv); err != nil {
+				vd.fail(fnode, p, err)
+			}
+			vd.walk(fv, p, fnode)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			vd.walk(v.Index(i), indexPath(path, i), node)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// make an addressable copy so pointer receivers can be called
+			val := reflect.New(iter.Value().Type()).Elem()
+			val.Set(iter.Value())
+			saved := vd.entry
+			vd.entry = mapScope{
+				base:      val.Addr().Pointer(),
+				size:      val.Type().Size(),
+				positions: vd.entries[mapEntry{m: v.Pointer(), key: iter.Key().Interface()}],
+			}
+			vd.walk(val, fmt.Sprintf("%s[%q]", path, fmt.Sprint(iter.Key().Interface())), node)
+			vd.entry = saved
+		}
+	}
+	if u, ok := asValidator(v); ok {
+		if err := u.Validate(); err != nil {
+			vd.fail(node, path, err)
+		}
+	}
+}
+
+// asValidator returns v, or a pointer to it, as a Validator
+func asValidator(v reflect.Value) (Validator, bool) {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(Validator); ok {
+			return u, true
+		}
+	}
+	if v.CanInterface() {
+		u, ok := v.Interface().(Validator)
+		return u, ok
+	}
+	return nil, false
+}
+
+// rule is a single validation rule from a validate tag
+type rule struct {
+	name string
+	arg  string
+}
+
+var rulesCache sync.Map // map[string][]rule
+
+// parseRules parses a validate tag
+func parseRules(tag string) ([]rule, error) {
+	if rr, ok := rulesCache.Load(tag); ok {
+		return rr.([]rule), nil
+	}
+	var rules []rule
+	rest := tag
+	for rest != "" {
+		var part string
+		if strings.HasPrefix(rest, "pattern=") {
+			part, rest = rest, ""
+		} else if i := strings.Index(rest, ","); i != -1 {
+			part, rest = rest[:i], rest[i+1:]
+		} else {
+			part, rest = rest, ""
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "nonempty":
+		case "len", "min", "max", "oneof":
+			if arg == "" {
+				return nil, fmt.Errorf("invalid validate tag %q: %s requires an argument", tag, name)
+			}
+		case "pattern":
+			if _, err := compilePattern(arg); err != nil {
+				return nil, fmt.Errorf("invalid validate tag %q: %v", tag, err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid validate tag %q: unknown rule %q", tag, name)
+		}
+		rules = append(rules, rule{name: name, arg: arg})
+	}
+	rulesCache.Store(tag, rules)
+	return rules, nil
+}
+
+var patternCache sync.Map // map[string]*regexp.Regexp
+
+// compilePattern is like regexp.Compile but caches the result
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(expr, re)
+	return re, nil
+}
+
+// checkRules returns an error for the first rule in the tag which v fails
+func checkRules(tag string, v reflect.Value) error {
+	if tag == "" {
+		return nil
+	}
+	rules, err := parseRules(tag)
+	if err != nil {
+		return err
+	}
+	// nil pointers only fail nonempty
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			for _, r := range rules {
+				if r.name == "nonempty" {
+					return fmt.Errorf("must not be empty")
+				}
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+	for _, r := range rules {
+		if err := r.check(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasLen returns true if the length of v is used by the rules
+func hasLen(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// check returns an error if v doesn't satisfy the rule
+func (r rule) check(v reflect.Value) error {
+	switch r.name {
+	case "nonempty":
+		if (hasLen(v) && v.Len() == 0) || (!hasLen(v) && v.IsZero()) {
+			return fmt.Errorf("must not be empty")
+		}
+	case "len":
+		n, err := strconv.Atoi(r.arg)
+		if err != nil || !hasLen(v) {
+			return r.invalid(v)
+		}
+		if v.Len() != n {
+			return fmt.Errorf("length must be %d", n)
+		}
+	case "min", "max":
+		if hasLen(v) {
+			n, err := strconv.Atoi(r.arg)
+			if err != nil {
+				return r.invalid(v)
+			}
+			if r.name == "min" && v.Len() < n {
+				return fmt.Errorf("length must be at least %d", n)
+			}
+			if r.name == "max" && v.Len() > n {
+				return fmt.Errorf("length must be at most %d", n)
+			}
+			return nil
+		}
+		x, ok := number(v)
+		bound, err := parseBound(r.arg)
+		if !ok || err != nil {
+			return r.invalid(v)
+		}
+		if r.name == "min" && x < bound {
+			return fmt.Errorf("must be at least %s", r.arg)
+		}
+		if r.name == "max" && x > bound {
+			return fmt.Errorf("must be at most %s", r.arg)
+		}
+	case "oneof":
+		options := strings.Fields(r.arg)
+		s := fmt.Sprint(v.Interface())
+		for _, o := range options {
+			if s == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+	case "pattern":
+		re, err := compilePattern(r.arg)
+		if err != nil || v.Kind() != reflect.String {
+			return r.invalid(v)
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Errorf("must match %s", r.arg)
+		}
+	}
+	return nil
+}
+
+// invalid returns an error for a rule which cannot be applied to v
+func (r rule) invalid(v reflect.Value) error {
+	return fmt.Errorf("invalid validate rule %s=%s for %v", r.name, r.arg, v.Type())
+}
+
+// number returns the numeric value of v
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// parseBound parses the argument of a min or max rule.
+// It uses the config value syntax so durations and sizes can be used.
+func parseBound(arg string) (float64, error) {
+	v, err := ast.ParseValue(arg)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case *ast.Number:
+		return v.Value, nil
+	case *ast.Quantity:
+		return float64(v.Value), nil
+	default:
+		return 0, fmt.Errorf("invalid bound %q", arg)
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type port int
+
+func (p port) Validate() error {
+	if p == 0 {
+		return fmt.Errorf("port cannot be zero")
+	}
+	return nil
+}
+
+type listener struct {
+	Addr string
+	TLS  bool
+}
+
+func (l *listener) Validate() error {
+	if l.TLS && l.Addr == ":80" {
+		return errors.New("TLS cannot be used on port 80")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	type Service struct {
+		Name     string        `config:",label" validate:"pattern=^[a-z]+$"`
+		ID       int           `validate:"min=1,max=65535"`
+		Level    string        `validate:"oneof=debug info warn"`
+		Deny     []string      `validate:"nonempty,max=2"`
+		Timeout  time.Duration `validate:"min=1s,max=1m"`
+		Buffer   int64         `validate:"max=1KiB"`
+		Code     string        `validate:"len=3"`
+		Port     port
+		Listener *listener
+	}
+	var c struct {
+		Service []*Service
+	}
+	input := `Service web {
+  ID = 1
+  Level = "info"
+  Deny = ["Reload"]
+  Timeout = 30s
+  Code = "abc"
+  Port = 80
+}
+Service BAD {
+  ID = 70000
+  Level = "trace"
+  Deny = []
+  Timeout = 5m
+  Buffer = 2KiB
+  Code = "abcd"
+  Listener {
+    Addr = ":80"
+    TLS = true
+  }
+}`
+	t.Run("Decoder", func(t *testing.T) {
+		var d Decoder
+		d.ValidateOnDecode(true)
+		err := d.Unmarshal([]byte(input), &c)
+		assert.Error(t, err, `9:13: Service[1].Name: must match ^[a-z]+$
+9:13: Service[1].Port: port cannot be zero
+10:8: Service[1].ID: must be at most 65535
+11:11: Service[1].Level: must be one of debug, info, warn
+12:10: Service[1].Deny: must not be empty
+13:13: Service[1].Timeout: must be at most 1m
+14:12: Service[1].Buffer: must be at most 1KiB
+15:10: Service[1].Code: length must be 3
+16:12: Service[1].Listener: TLS cannot be used on port 80`)
+		var list ErrorList
+		assert.Assert(t, errors.As(err, &list))
+		var verr *ValidationError
+		assert.Assert(t, errors.As(list[0], &verr))
+		assert.Equal(t, verr.Path, "Service[1].Name")
+	})
+	t.Run("ListElement", func(t *testing.T) {
+		var c struct {
+			Ports []port
+		}
+		var d Decoder
+		d.ValidateOnDecode(true)
+		err := d.Unmarshal([]byte("Ports = [1, 2, 0, 3]"), &c)
+		assert.Error(t, err, "1:16: Ports[2]: port cannot be zero")
+	})
+	t.Run("MapValue", func(t *testing.T) {
+		type Backend struct {
+			Addr string `validate:"nonempty"`
+			Port port
+		}
+		var c struct {
+			Backend map[string]Backend
+			Pools   map[string]map[string]*Backend
+		}
+		input := `Backend a {
+  Addr = ""
+  Port = 0
+}
+Backend b {
+  Addr = "b"
+}
+Pools {
+  east {
+    c = { Addr = "", Port = 1 }
+  }
+}`
+		var d Decoder
+		d.ValidateOnDecode(true)
+		err := d.Unmarshal([]byte(input), &c)
+		assert.Error(t, err, `2:10: Backend["a"].Addr: must not be empty
+3:10: Backend["a"].Port: port cannot be zero
+5:11: Backend["b"].Port: port cannot be zero
+10:18: Pools["east"]["c"].Addr: must not be empty`)
+	})
+	t.Run("Func", func(t *testing.T) {
+		err := Validate(&c)
+		assert.ErrorContains(t, err, "Service[1].ID: must be at most 65535")
+	})
+}
+
+func TestValidateTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		message string
+	}{
+		{
+			name: "UnknownRule",
+			value: struct {
+				A int `validate:"positive"`
+			}{},
+			message: `A: invalid validate tag "positive": unknown rule "positive"`,
+		},
+		{
+			name: "BadPattern",
+			value: struct {
+				A string `validate:"pattern=("`
+			}{},
+			message: "A: invalid validate tag \"pattern=(\": error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name: "WrongKind",
+			value: struct {
+				A bool `validate:"len=1"`
+			}{},
+			message: "A: invalid validate rule len=1 for bool",
+		},
+		{
+			name: "PatternWithComma",
+			value: struct {
+				A string `validate:"nonempty,pattern=^a{1,2}$"`
+			}{A: "aaa"},
+			message: "A: must match ^a{1,2}$",
+		},
+		{
+			name: "NilPointer",
+			value: struct {
+				A *int `validate:"nonempty,min=1"`
+				B *int `validate:"min=1"`
+			}{},
+			message: "A: must not be empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, Validate(tt.value), tt.message)
+		})
+	}
+}